@@ -0,0 +1,217 @@
+package main
+
+import (
+	"log"
+	"os/exec"
+	"time"
+)
+
+type actionKind int
+
+const (
+	// actionButton is triggered when a button is pressed
+	actionButton actionKind = iota
+	// actionTouch is triggered when a button is pressed (value > 0) and released (value 0)
+	actionTouch
+	// actionControl is triggered with the value of a fader or encoder
+	actionControl
+)
+
+type actionHandler func(h *EventHandler, args []string, value uint8)
+
+type actionDefinition struct {
+	kind    actionKind
+	minArgs int
+	maxArgs int
+	// validArgs lists the accepted arguments, any argument is accepted when it is empty
+	validArgs []string
+	handler   actionHandler
+}
+
+// faderActions are the actions of which the value is written by a Fader, the touch of a fader names its action
+var faderActions = []string{"mixer.volume", "mixer.player-volume", "mic.gain"}
+
+var actions = map[string]actionDefinition{
+	"player.previous":        {kind: actionButton, handler: actionPlayerPrevious},
+	"player.next":            {kind: actionButton, handler: actionPlayerNext},
+	"player.stop":            {kind: actionButton, handler: actionPlayerStop},
+	"player.play":            {kind: actionButton, handler: actionPlayerPlay},
+	"player.pause":           {kind: actionButton, handler: actionPlayerPause},
+	"player.play-pause":      {kind: actionButton, handler: actionPlayerPlayPause},
+	"player.select-previous": {kind: actionButton, handler: actionPlayerSelectPrevious},
+	"player.select-next":     {kind: actionButton, handler: actionPlayerSelectNext},
+	"player.lock":            {kind: actionButton, handler: actionPlayerLock},
+	"display.cycle":          {kind: actionButton, handler: actionDisplayCycle},
+	"display.scroll":         {kind: actionControl, handler: actionDisplayScroll},
+	"segment.toggle":         {kind: actionButton, handler: actionSegmentToggle},
+	"seek.toggle":            {kind: actionButton, handler: actionSeekToggle},
+	"mixer.volume":           {kind: actionControl, handler: actionMixerVolume},
+	"mixer.player-volume":    {kind: actionControl, handler: actionMixerPlayerVolume},
+	"mixer.touch":            {kind: actionTouch, minArgs: 1, maxArgs: 1, validArgs: faderActions, handler: actionMixerTouch},
+	"mixer.output-previous":  {kind: actionButton, handler: actionMixerOutputPrevious},
+	"mixer.output-next":      {kind: actionButton, handler: actionMixerOutputNext},
+	"mixer.mute":             {kind: actionButton, maxArgs: 2, validArgs: []string{"sink", "source"}, handler: actionMixerMute},
+	"mic.mute":               {kind: actionButton, handler: actionMicMute},
+	"mic.gain":               {kind: actionControl, maxArgs: 1, validArgs: []string{"fader", "encoder"}, handler: actionMicGain},
+	"exec":                   {kind: actionButton, minArgs: 1, maxArgs: -1, handler: actionExec},
+}
+
+func actionPlayerPrevious(h *EventHandler, args []string, value uint8) {
+	if h.player != nil {
+		h.player.Previous()
+		h.player.Play()
+	}
+}
+
+func actionPlayerNext(h *EventHandler, args []string, value uint8) {
+	if h.player != nil {
+		h.player.Next()
+		h.player.Play()
+	}
+}
+
+func actionPlayerStop(h *EventHandler, args []string, value uint8) {
+	if h.player != nil {
+		h.player.Stop()
+	}
+}
+
+func actionPlayerPlay(h *EventHandler, args []string, value uint8) {
+	if h.player != nil {
+		h.player.Play()
+	}
+}
+
+func actionPlayerPause(h *EventHandler, args []string, value uint8) {
+	if h.player != nil {
+		h.player.Pause()
+	}
+}
+
+func actionPlayerPlayPause(h *EventHandler, args []string, value uint8) {
+	if h.player != nil {
+		h.player.PlayPause()
+	}
+}
+
+func actionPlayerSelectPrevious(h *EventHandler, args []string, value uint8) {
+	h.monitor.SelectPlayer(-1)
+}
+
+func actionPlayerSelectNext(h *EventHandler, args []string, value uint8) {
+	h.monitor.SelectPlayer(+1)
+}
+
+func actionPlayerLock(h *EventHandler, args []string, value uint8) {
+	h.SetActionLed("player.lock", h.monitor.ToggleLock())
+}
+
+func actionDisplayCycle(h *EventHandler, args []string, value uint8) {
+	h.SetDisplayMode((h.displayMode + 1) % len(displayModeNames))
+}
+
+func actionDisplayScroll(h *EventHandler, args []string, value uint8) {
+	if h.seekMode {
+		h.Seek(value)
+		return
+	}
+
+	if h.config.Progress.Ring {
+		// the LED ring shows the progress, so the encoder is turned relative to the last value written to it
+		h.displayScroll = int(clampMidiValue(h.displayScroll + int(value) - int(h.encoderRing)))
+		h.scrollFeedbackUntil = time.Now().Add(scrollFeedbackDuration)
+		h.UpdateEncoderRing()
+	} else {
+		h.displayScroll = int(value)
+	}
+
+	h.UpdateDisplay()
+}
+
+func actionSegmentToggle(h *EventHandler, args []string, value uint8) {
+	h.SetSegmentDisplayMode((h.segmentDisplayMode + 1) % segmentDisplayModes)
+}
+
+func actionSeekToggle(h *EventHandler, args []string, value uint8) {
+	h.seekMode = !h.seekMode
+
+	h.SetActionLed("seek.toggle", h.seekMode)
+	h.UpdateEncoderRing()
+}
+
+func actionMixerVolume(h *EventHandler, args []string, value uint8) {
+	h.faders["mixer.volume"].Input(value)
+}
+
+func actionMixerPlayerVolume(h *EventHandler, args []string, value uint8) {
+	h.faders["mixer.player-volume"].Input(value)
+}
+
+// actionMixerTouch holds the motor of the fader of the action given as argument while it is touched
+func actionMixerTouch(h *EventHandler, args []string, value uint8) {
+	h.faders[args[0]].Touch(value > 0)
+}
+
+func actionMixerOutputPrevious(h *EventHandler, args []string, value uint8) {
+	h.CycleOutput(-1)
+}
+
+func actionMixerOutputNext(h *EventHandler, args []string, value uint8) {
+	h.CycleOutput(+1)
+}
+
+// actionMixerMute mutes the default sink, or the targets given as arguments. When all of them are muted already,
+// they are unmuted.
+func actionMixerMute(h *EventHandler, args []string, value uint8) {
+	sink, source := muteTargets(args)
+	muted := !h.muteTargetsMuted(args)
+
+	if sink {
+		h.mixer.SetSinkMute(muted)
+	}
+	if source {
+		h.SetMicMute(muted)
+	}
+}
+
+func actionMicMute(h *EventHandler, args []string, value uint8) {
+	h.SetMicMute(!h.micMuted && !h.sourceMuted)
+}
+
+func actionMicGain(h *EventHandler, args []string, value uint8) {
+	h.faders["mic.gain"].Input(value)
+}
+
+func muteTargets(args []string) (sink bool, source bool) {
+	if len(args) == 0 {
+		return true, false
+	}
+
+	for _, arg := range args {
+		switch arg {
+		case "sink":
+			sink = true
+		case "source":
+			source = true
+		}
+	}
+
+	return sink, source
+}
+
+func actionExec(h *EventHandler, args []string, value uint8) {
+	cmd := exec.Command(args[0], args[1:]...)
+
+	err := cmd.Start()
+	if err != nil {
+		log.Printf("error while starting %s: %v", args[0], err)
+		return
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			log.Printf("command %s exited with error: %v", args[0], err)
+		}
+	}()
+}
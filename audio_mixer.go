@@ -1,18 +1,91 @@
 package main
 
 import (
+	"fmt"
 	"github.com/mafik/pulseaudio"
 	"log"
+	"sync"
+	"time"
 )
 
+// mixerReadDelay is the time the mixer waits after a change on the server before reading its state, so the bursts of
+// changes the server sends are read at once
+const mixerReadDelay = 50 * time.Millisecond
+
+// AudioMixer follows and changes the volumes and mute states on the PulseAudio server. The state is read by a
+// goroutine, as part of it is read with pactl, and handed to the event loop with Updates. Changes made with pactl are
+// written by another goroutine, so the event loop never waits for pactl.
 type AudioMixer struct {
 	client               *pulseaudio.Client
+	updates              chan mixerState
 	volumeChangeCallback func(volume float32)
 	volume               float32
+	// sink is the name of the sink controlled by the volume, or empty for the default sink
+	sink string
+
+	sinkMuted          bool
+	sourceMuted        bool
+	muteChangeCallback func(sinkMuted bool, sourceMuted bool)
+
+	// the default source is only tracked when it is used, as it is read with pactl
+	trackSource                bool
+	sourceVolume               float32
+	sourceVolumeChangeCallback func(volume float32)
+
+	// callApplications are the applications of which a recording stream is a call, calls are not tracked when empty
+	callApplications   []string
+	callActive         bool
+	callChangeCallback func(active bool)
+
+	// the streams of the player are only looked up while a player is followed, as this runs pactl
+	player                     *DbusMediaPlayer
+	playerSinkInputs           []SinkInput
+	playerVolume               float32
+	playerVolumeChangeCallback func(volume float32)
+	// playerFollowed is set when another player was followed, so its volume is announced even when it is the same
+	playerFollowed bool
+
+	// target is what the reader reads, which is shared with the event loop. refresh makes the reader read the state
+	// without a change on the server.
+	targetMutex sync.Mutex
+	target      mixerTarget
+	refresh     chan struct{}
+
+	writes *writeQueue
+}
+
+// mixerTarget is what the reader of the mixer reads besides the default sink
+type mixerTarget struct {
+	source bool
+	calls  []string
+	player *DbusMediaPlayer
+}
+
+// mixerState is the state of the server as it was read by the reader. The ok fields are false when a part could not
+// be read, which is then not updated.
+type mixerState struct {
+	volume       float32
+	volumeOK     bool
+	sinkMuted    bool
+	sinkMutedOK  bool
+	sourceMuted  bool
+	sourceVolume float32
+	// sourceOK is false as well when the source was not tracked yet when the state was read
+	sourceOK   bool
+	callActive bool
+	callOK     bool
+	// player is the player of which playerSinkInputs are the streams
+	player           *DbusMediaPlayer
+	playerSinkInputs []SinkInput
 }
 
-func NewAudioMixer() *AudioMixer {
-	return &AudioMixer{}
+func NewAudioMixer(config MixerConfig) *AudioMixer {
+	return &AudioMixer{
+		sink:    config.Sink,
+		updates: make(chan mixerState),
+		refresh: make(chan struct{}, 1),
+		writes:  newWriteQueue(),
+	}
 }
 
 func (m *AudioMixer) Init() error {
@@ -23,30 +96,123 @@ func (m *AudioMixer) Init() error {
 	}
 
 	m.client = client
-	m.volume, _ = m.client.Volume()
+	m.volume, _ = m.readVolume()
+	m.sinkMuted, _ = m.readSinkMute()
 
-	updates, err := m.client.Updates()
+	serverUpdates, err := m.client.Updates()
 	if err != nil {
 		return err
 	}
 
-	go func() {
-		for range updates {
-			volume, _ := m.client.Volume()
-			if m.volume != volume {
-				m.volume = volume
-				if m.volumeChangeCallback != nil {
-					m.volumeChangeCallback(m.volume)
-				}
+	go m.read(serverUpdates)
+
+	return nil
+}
+
+// Updates returns the channel which receives the state of the server after it changed, which has to be passed to
+// Update by the event loop
+func (m *AudioMixer) Updates() <-chan mixerState {
+	return m.updates
+}
+
+// Update takes the state read after a change on the server and calls the callbacks of what changed
+func (m *AudioMixer) Update(state mixerState) {
+	if state.volumeOK && state.volume != m.volume {
+		m.volume = state.volume
+		if m.volumeChangeCallback != nil {
+			m.volumeChangeCallback(m.volume)
+		}
+	}
+
+	m.updateMute(state)
+	m.updateCall(state)
+	m.updatePlayerVolume(state)
+}
+
+// read reads the state of the server after every change, and hands it to the event loop
+func (m *AudioMixer) read(serverUpdates <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-serverUpdates:
+			if !ok {
+				return
 			}
+		case <-m.refresh:
 		}
-	}()
 
-	return nil
+		time.Sleep(mixerReadDelay)
+		select {
+		case <-serverUpdates:
+		default:
+		}
+		select {
+		case <-m.refresh:
+		default:
+		}
+
+		m.updates <- m.readState()
+	}
+}
+
+// requestRead makes the reader read the state, even when nothing changed on the server
+func (m *AudioMixer) requestRead() {
+	select {
+	case m.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// setTarget changes what the reader reads, and makes it read the state
+func (m *AudioMixer) setTarget(change func(target *mixerTarget)) {
+	m.targetMutex.Lock()
+	change(&m.target)
+	m.targetMutex.Unlock()
+
+	m.requestRead()
+}
+
+func (m *AudioMixer) readState() mixerState {
+	m.targetMutex.Lock()
+	target := m.target
+	m.targetMutex.Unlock()
+
+	var state mixerState
+	var err error
+
+	state.volume, err = m.readVolume()
+	state.volumeOK = err == nil
+
+	state.sinkMuted, err = m.readSinkMute()
+	state.sinkMutedOK = err == nil
+
+	if target.source {
+		var volumeErr error
+		state.sourceMuted, err = GetSourceMute()
+		state.sourceVolume, volumeErr = GetSourceVolume()
+		state.sourceOK = err == nil && volumeErr == nil
+	}
+
+	if len(target.calls) != 0 {
+		state.callActive, err = findCall(target.calls)
+		if err != nil {
+			log.Print(err)
+		}
+		state.callOK = err == nil
+	}
+
+	state.player = target.player
+	state.playerSinkInputs = findPlayerSinkInputs(target.player)
+
+	return state
 }
 
 func (m *AudioMixer) SetVolume(volume float32) {
-	err := m.client.SetVolume(volume)
+	var err error
+	if len(m.sink) != 0 {
+		err = m.client.SetSinkVolume(m.sink, volume)
+	} else {
+		err = m.client.SetVolume(volume)
+	}
 
 	if err != nil {
 		log.Printf("error while setting volume %v", err)
@@ -56,3 +222,308 @@ func (m *AudioMixer) SetVolume(volume float32) {
 func (m *AudioMixer) SetOnVolumeChangeCallback(callback func(volume float32)) {
 	m.volumeChangeCallback = callback
 }
+
+func (m *AudioMixer) readVolume() (float32, error) {
+	if len(m.sink) != 0 {
+		return GetSinkVolume(m.sink)
+	}
+
+	return m.client.Volume()
+}
+
+// CycleSink makes the sink offset places from the default sink the default, moves all streams to it and returns it
+func (m *AudioMixer) CycleSink(offset int) (*Sink, error) {
+	sinks, err := ListSinks()
+	if err != nil {
+		return nil, err
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("no sinks found")
+	}
+
+	server, err := m.client.ServerInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	current := 0
+	for i, sink := range sinks {
+		if sink.Name == server.DefaultSink {
+			current = i
+		}
+	}
+	sink := sinks[((current+offset)%len(sinks)+len(sinks))%len(sinks)]
+
+	err = SetDefaultSink(sink.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	sinkInputs, err := ListSinkInputs()
+	if err != nil {
+		return nil, err
+	}
+	for _, input := range sinkInputs {
+		if input.Sink != sink.Index {
+			err := MoveSinkInput(input.Index, sink.Name)
+			if err != nil {
+				log.Print(err)
+			}
+		}
+	}
+
+	return &sink, nil
+}
+
+// TrackSource makes the mute state and volume of the default source tracked as well
+func (m *AudioMixer) TrackSource() {
+	m.trackSource = true
+	m.sourceMuted, _ = GetSourceMute()
+	m.sourceVolume, _ = GetSourceVolume()
+
+	m.setTarget(func(target *mixerTarget) {
+		target.source = true
+	})
+}
+
+func (m *AudioMixer) SourceVolume() float32 {
+	return m.sourceVolume
+}
+
+func (m *AudioMixer) SetSourceVolume(volume float32) {
+	m.writes.Write("source-volume", func() error {
+		return SetSourceVolume(volume)
+	})
+}
+
+func (m *AudioMixer) SetOnSourceVolumeChangeCallback(callback func(volume float32)) {
+	m.sourceVolumeChangeCallback = callback
+}
+
+func (m *AudioMixer) Muted() (sinkMuted bool, sourceMuted bool) {
+	return m.sinkMuted, m.sourceMuted
+}
+
+// SetSinkMute mutes the pinned sink, or the default sink
+func (m *AudioMixer) SetSinkMute(muted bool) {
+	if len(m.sink) != 0 {
+		sink := m.sink
+		m.writes.Write("sink-mute", func() error {
+			return SetSinkMute(sink, muted)
+		})
+		return
+	}
+
+	err := m.client.SetMute(muted)
+	if err != nil {
+		log.Printf("error while setting mute %v", err)
+	}
+}
+
+func (m *AudioMixer) readSinkMute() (bool, error) {
+	if len(m.sink) != 0 {
+		return GetSinkMute(m.sink)
+	}
+
+	return m.client.Mute()
+}
+
+func (m *AudioMixer) SetSourceMute(muted bool) {
+	m.writes.Write("source-mute", func() error {
+		return SetSourceMute(muted)
+	})
+}
+
+func (m *AudioMixer) SetOnMuteChangeCallback(callback func(sinkMuted bool, sourceMuted bool)) {
+	m.muteChangeCallback = callback
+}
+
+// updateMute updates the mute states, and the volume of the default source when it is tracked
+func (m *AudioMixer) updateMute(state mixerState) {
+	if !state.sinkMutedOK || m.trackSource && !state.sourceOK {
+		return
+	}
+
+	if m.trackSource && state.sourceVolume != m.sourceVolume {
+		m.sourceVolume = state.sourceVolume
+		if m.sourceVolumeChangeCallback != nil {
+			m.sourceVolumeChangeCallback(state.sourceVolume)
+		}
+	}
+
+	if state.sinkMuted != m.sinkMuted || state.sourceMuted != m.sourceMuted {
+		m.sinkMuted, m.sourceMuted = state.sinkMuted, state.sourceMuted
+		if m.muteChangeCallback != nil {
+			m.muteChangeCallback(state.sinkMuted, state.sourceMuted)
+		}
+	}
+}
+
+// TrackCalls makes the recording streams of the given applications tracked as calls
+func (m *AudioMixer) TrackCalls(applications []string) {
+	m.callApplications = applications
+
+	m.setTarget(func(target *mixerTarget) {
+		target.calls = applications
+	})
+}
+
+func (m *AudioMixer) SetOnCallChangeCallback(callback func(active bool)) {
+	m.callChangeCallback = callback
+}
+
+func (m *AudioMixer) updateCall(state mixerState) {
+	if len(m.callApplications) == 0 || !state.callOK {
+		return
+	}
+
+	if state.callActive != m.callActive {
+		m.callActive = state.callActive
+		if m.callChangeCallback != nil {
+			m.callChangeCallback(state.callActive)
+		}
+	}
+}
+
+// findCall returns true when one of the given applications has a recording stream
+func findCall(applications []string) (bool, error) {
+	sourceOutputs, err := ListSourceOutputs()
+	if err != nil {
+		return false, err
+	}
+
+	for _, output := range sourceOutputs {
+		if output.MatchesApplication(applications) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// FollowPlayer makes the player volume that of the streams of the given player, which may be nil. The volume is
+// announced once the streams were looked up.
+func (m *AudioMixer) FollowPlayer(player *DbusMediaPlayer) {
+	m.player = player
+	m.playerSinkInputs = nil
+	m.playerFollowed = true
+
+	m.setTarget(func(target *mixerTarget) {
+		target.player = player
+	})
+}
+
+// PlayerVolume returns the volume of the streams of the followed player, or 0 when it has none
+func (m *AudioMixer) PlayerVolume() float32 {
+	return m.playerVolume
+}
+
+// SetPlayerVolume sets the volume of all streams of the followed player. The streams are looked up again on every
+// update of the server, so they are cached here.
+func (m *AudioMixer) SetPlayerVolume(volume float32) {
+	for _, input := range m.playerSinkInputs {
+		index := input.Index
+		m.writes.Write(fmt.Sprintf("sink-input-volume %d", index), func() error {
+			return SetSinkInputVolume(index, volume)
+		})
+	}
+}
+
+func (m *AudioMixer) SetOnPlayerVolumeChangeCallback(callback func(volume float32)) {
+	m.playerVolumeChangeCallback = callback
+}
+
+func (m *AudioMixer) updatePlayerVolume(state mixerState) {
+	// the state was read for a player which is not followed anymore, the state of the followed one is read next
+	if state.player != m.player {
+		return
+	}
+	if m.player == nil && !m.playerFollowed {
+		return
+	}
+
+	volume := float32(0)
+	if len(state.playerSinkInputs) != 0 {
+		volume = state.playerSinkInputs[0].Volume
+	}
+
+	changed := m.playerFollowed || volume != m.playerVolume
+	m.playerSinkInputs = state.playerSinkInputs
+	m.playerVolume = volume
+	m.playerFollowed = false
+
+	if changed && m.playerVolumeChangeCallback != nil {
+		m.playerVolumeChangeCallback(volume)
+	}
+}
+
+func findPlayerSinkInputs(player *DbusMediaPlayer) []SinkInput {
+	if player == nil {
+		return nil
+	}
+
+	sinkInputs, err := ListSinkInputs()
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+
+	return FindPlayerSinkInputs(sinkInputs, player.pid, player.nameLower, readProcStat)
+}
+
+// writeQueue runs writes in the background, so the event loop does not wait for them. Only the latest write of every
+// key is run, so writes which were superseded while an earlier one ran, like of a moving fader, are dropped.
+type writeQueue struct {
+	mutex   sync.Mutex
+	pending map[string]func() error
+	keys    []string
+	wake    chan struct{}
+}
+
+func newWriteQueue() *writeQueue {
+	q := &writeQueue{
+		pending: make(map[string]func() error),
+		wake:    make(chan struct{}, 1),
+	}
+
+	go q.run()
+
+	return q
+}
+
+// Write queues write, replacing the queued write of the same key
+func (q *writeQueue) Write(key string, write func() error) {
+	q.mutex.Lock()
+	if _, ok := q.pending[key]; !ok {
+		q.keys = append(q.keys, key)
+	}
+	q.pending[key] = write
+	q.mutex.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *writeQueue) run() {
+	for range q.wake {
+		for {
+			q.mutex.Lock()
+			if len(q.keys) == 0 {
+				q.mutex.Unlock()
+				break
+			}
+			key := q.keys[0]
+			q.keys = q.keys[1:]
+			write := q.pending[key]
+			delete(q.pending, key)
+			q.mutex.Unlock()
+
+			err := write()
+			if err != nil {
+				log.Print(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type BindingConfig struct {
+	Note    *uint8   `toml:"note"`
+	Control *uint8   `toml:"control"`
+	Action  string   `toml:"action"`
+	Args    []string `toml:"args"`
+}
+
+type Binding struct {
+	action string
+	args   []string
+	kind   actionKind
+	handle actionHandler
+}
+
+type Bindings struct {
+	notes    map[uint8]*Binding
+	controls map[uint8]*Binding
+}
+
+func NewBindings(configs []BindingConfig) (*Bindings, error) {
+	b := &Bindings{
+		notes:    make(map[uint8]*Binding),
+		controls: make(map[uint8]*Binding),
+	}
+
+	for i, config := range configs {
+		binding, err := newBinding(config)
+		if err != nil {
+			return nil, fmt.Errorf("binding %d: %v", i+1, err)
+		}
+
+		if config.Note != nil {
+			if _, found := b.notes[*config.Note]; found {
+				return nil, fmt.Errorf("binding %d: note %d is already bound", i+1, *config.Note)
+			}
+			b.notes[*config.Note] = binding
+		} else {
+			if _, found := b.controls[*config.Control]; found {
+				return nil, fmt.Errorf("binding %d: control %d is already bound", i+1, *config.Control)
+			}
+			b.controls[*config.Control] = binding
+		}
+	}
+
+	return b, nil
+}
+
+func newBinding(config BindingConfig) (*Binding, error) {
+	if config.Note == nil && config.Control == nil {
+		return nil, fmt.Errorf("either note or control must be set")
+	}
+	if config.Note != nil && config.Control != nil {
+		return nil, fmt.Errorf("note and control cannot both be set")
+	}
+	if config.Note != nil && *config.Note > 127 {
+		return nil, fmt.Errorf("note %d is out of range 0-127", *config.Note)
+	}
+	if config.Control != nil && *config.Control > 127 {
+		return nil, fmt.Errorf("control %d is out of range 0-127", *config.Control)
+	}
+
+	definition, ok := actions[config.Action]
+	if !ok {
+		return nil, fmt.Errorf("unknown action %q, expected one of %s", config.Action, strings.Join(actionNames(), ", "))
+	}
+
+	if definition.kind == actionControl && config.Control == nil {
+		return nil, fmt.Errorf("action %s can only be bound to a control", config.Action)
+	}
+
+	err := validateActionArgs(config.Action, definition, config.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Binding{
+		action: config.Action,
+		args:   config.Args,
+		kind:   definition.kind,
+		handle: definition.handler,
+	}, nil
+}
+
+func validateActionArgs(action string, definition actionDefinition, args []string) error {
+	if len(args) < definition.minArgs {
+		return fmt.Errorf("action %s needs at least %d argument(s)", action, definition.minArgs)
+	}
+	if definition.maxArgs >= 0 && len(args) > definition.maxArgs {
+		return fmt.Errorf("action %s takes at most %d argument(s)", action, definition.maxArgs)
+	}
+
+	for _, arg := range args {
+		if len(definition.validArgs) != 0 && !containsString(definition.validArgs, arg) {
+			return fmt.Errorf("invalid argument %q for action %s, expected one of %s", arg, action,
+				strings.Join(definition.validArgs, ", "))
+		}
+	}
+
+	return nil
+}
+
+func (b *Bindings) Note(key uint8) *Binding {
+	return b.notes[key]
+}
+
+func (b *Bindings) Control(controller uint8) *Binding {
+	return b.controls[controller]
+}
+
+// NotesFor returns the notes bound to the given action, so their LEDs can reflect its state
+func (b *Bindings) NotesFor(action string) []uint8 {
+	var notes []uint8
+	for note, binding := range b.notes {
+		if binding.action == action {
+			notes = append(notes, note)
+		}
+	}
+
+	return notes
+}
+
+// ControlsFor returns the controls bound to the given action, so they can receive feedback or light their LEDs
+func (b *Bindings) ControlsFor(action string) []uint8 {
+	var controls []uint8
+	for controller, binding := range b.controls {
+		if binding.action == action {
+			controls = append(controls, controller)
+		}
+	}
+
+	return controls
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func actionNames() []string {
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
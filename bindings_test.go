@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNewBindings(t *testing.T) {
+	note := uint8Pointer
+	control := uint8Pointer
+
+	tests := []struct {
+		name    string
+		configs []BindingConfig
+		// err is a part of the expected error, the bindings are valid when it is empty
+		err string
+	}{
+		{
+			name: "valid bindings",
+			configs: []BindingConfig{
+				{Note: note(0), Action: "player.play-pause"},
+				{Note: note(127), Action: "mixer.mute", Args: []string{"sink", "source"}},
+				{Note: note(110), Action: "mixer.touch", Args: []string{"mixer.volume"}},
+				{Control: control(0), Action: "player.next"},
+				{Control: control(70), Action: "mixer.volume"},
+				{Control: control(127), Action: "mic.gain", Args: []string{"encoder"}},
+				{Note: note(1), Action: "exec", Args: []string{"notify-send", "hello", "world"}},
+			},
+		},
+		{
+			name: "the same number as note and control",
+			configs: []BindingConfig{
+				{Note: note(5), Action: "player.next"},
+				{Control: control(5), Action: "mixer.volume"},
+			},
+		},
+		{
+			name:    "no note or control",
+			configs: []BindingConfig{{Action: "player.next"}},
+			err:     "binding 1: either note or control must be set",
+		},
+		{
+			name:    "note and control",
+			configs: []BindingConfig{{Note: note(1), Control: control(1), Action: "player.next"}},
+			err:     "binding 1: note and control cannot both be set",
+		},
+		{
+			name:    "note out of range",
+			configs: []BindingConfig{{Note: note(128), Action: "player.next"}},
+			err:     "note 128 is out of range 0-127",
+		},
+		{
+			name:    "control out of range",
+			configs: []BindingConfig{{Control: control(200), Action: "mixer.volume"}},
+			err:     "control 200 is out of range 0-127",
+		},
+		{
+			name:    "unknown action",
+			configs: []BindingConfig{{Note: note(1), Action: "player.rewind"}},
+			err:     `unknown action "player.rewind"`,
+		},
+		{
+			name:    "control action bound to a note",
+			configs: []BindingConfig{{Note: note(1), Action: "mixer.volume"}},
+			err:     "action mixer.volume can only be bound to a control",
+		},
+		{
+			name: "duplicate note",
+			configs: []BindingConfig{
+				{Note: note(1), Action: "player.next"},
+				{Note: note(1), Action: "player.previous"},
+			},
+			err: "binding 2: note 1 is already bound",
+		},
+		{
+			name: "duplicate control",
+			configs: []BindingConfig{
+				{Control: control(70), Action: "mixer.volume"},
+				{Control: control(70), Action: "mic.gain"},
+			},
+			err: "binding 2: control 70 is already bound",
+		},
+		{
+			name:    "missing argument",
+			configs: []BindingConfig{{Note: note(110), Action: "mixer.touch"}},
+			err:     "action mixer.touch needs at least 1 argument(s)",
+		},
+		{
+			name:    "argument of an action without arguments",
+			configs: []BindingConfig{{Note: note(1), Action: "player.next", Args: []string{"now"}}},
+			err:     "action player.next takes at most 0 argument(s)",
+		},
+		{
+			name:    "too many arguments",
+			configs: []BindingConfig{{Note: note(1), Action: "mixer.mute", Args: []string{"sink", "source", "sink"}}},
+			err:     "action mixer.mute takes at most 2 argument(s)",
+		},
+		{
+			name:    "invalid argument",
+			configs: []BindingConfig{{Note: note(110), Action: "mixer.touch", Args: []string{"mixer.mute"}}},
+			err:     `invalid argument "mixer.mute" for action mixer.touch`,
+		},
+		{
+			name:    "missing argument of exec",
+			configs: []BindingConfig{{Note: note(1), Action: "exec"}},
+			err:     "action exec needs at least 1 argument(s)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bindings, err := NewBindings(test.configs)
+
+			if len(test.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			for _, config := range test.configs {
+				var binding *Binding
+				if config.Note != nil {
+					binding = bindings.Note(*config.Note)
+				} else {
+					binding = bindings.Control(*config.Control)
+				}
+
+				if binding == nil || binding.action != config.Action || !reflect.DeepEqual(binding.args, config.Args) {
+					t.Errorf("expected binding %+v, got %+v", config, binding)
+				}
+			}
+		})
+	}
+}
+
+func TestBindingsFor(t *testing.T) {
+	bindings, err := NewBindings([]BindingConfig{
+		{Note: uint8Pointer(1), Action: "mic.mute"},
+		{Note: uint8Pointer(2), Action: "mic.mute"},
+		{Note: uint8Pointer(3), Action: "player.next"},
+		{Control: uint8Pointer(4), Action: "mic.mute"},
+		{Control: uint8Pointer(70), Action: "mic.gain"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notes := bindings.NotesFor("mic.mute")
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i] < notes[j]
+	})
+	if !reflect.DeepEqual(notes, []uint8{1, 2}) {
+		t.Errorf("expected notes [1 2], got %v", notes)
+	}
+	if controls := bindings.ControlsFor("mic.mute"); !reflect.DeepEqual(controls, []uint8{4}) {
+		t.Errorf("expected controls [4], got %v", controls)
+	}
+	if notes := bindings.NotesFor("mic.gain"); len(notes) != 0 {
+		t.Errorf("expected no notes, got %v", notes)
+	}
+}
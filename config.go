@@ -0,0 +1,221 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed profiles/*.toml
+var profileBindings embed.FS
+
+type Config struct {
+	Device   DeviceConfig    `toml:"device"`
+	Players  PlayersConfig   `toml:"players"`
+	Mixer    MixerConfig     `toml:"mixer"`
+	Calls    CallsConfig     `toml:"calls"`
+	Seek     SeekConfig      `toml:"seek"`
+	Progress ProgressConfig  `toml:"progress"`
+	VuMeter  VuMeterConfig   `toml:"vu_meter"`
+	Control  ControlConfig   `toml:"control"`
+	Http     HttpConfig      `toml:"http"`
+	Bindings []BindingConfig `toml:"binding"`
+}
+
+type DeviceConfig struct {
+	Profile string `toml:"profile"`
+	Mode    string `toml:"mode"`
+	In      string `toml:"in"`
+	Out     string `toml:"out"`
+}
+
+type PlayersConfig struct {
+	// Follow makes a player which starts playing the active player
+	Follow bool `toml:"follow"`
+	// Exclusive pauses the other players when a player starts playing
+	Exclusive bool `toml:"exclusive"`
+	// ExclusiveExempt are the players, by identity or bus name, which are not paused and do not pause others
+	ExclusiveExempt []string `toml:"exclusive_exempt"`
+	// Order is the order in which the players are selected: registration, alphabetical or priority
+	Order string `toml:"order"`
+	// Priority are the players, by identity or bus name, in the order in which they are selected for the priority
+	// order
+	Priority []string `toml:"priority"`
+	// Remember selects the last selected player again after a restart, when it appears
+	Remember bool `toml:"remember"`
+	// Proxy exports a player which forwards to the active player, so all MPRIS clients follow the selection
+	Proxy bool `toml:"proxy"`
+}
+
+type MixerConfig struct {
+	// Sink is the name of the sink of which the volume is controlled, instead of the default sink
+	Sink string `toml:"sink"`
+	// Curve maps the fader positions to volumes: cubic, linear or db
+	Curve string `toml:"curve"`
+	// DbFloor is the volume at the bottom of the fader for the db curve
+	DbFloor float64 `toml:"db_floor"`
+}
+
+type CallsConfig struct {
+	// Pause pauses the active player while one of the applications records from a microphone
+	Pause bool `toml:"pause"`
+	// Applications are the application names, process binaries or stream names which count as calls
+	Applications []string `toml:"applications"`
+}
+
+type SeekConfig struct {
+	// Step is the number of seconds seeked per step of the encoder
+	Step float64 `toml:"step"`
+	// Acceleration is added to the step multiplier for every step which quickly follows the previous one
+	Acceleration float64 `toml:"acceleration"`
+	// MaxStep limits the accelerated step, in seconds
+	MaxStep float64 `toml:"max_step"`
+}
+
+type ProgressConfig struct {
+	// Ring shows the progress of the track on the LED ring of the encoder
+	Ring bool `toml:"ring"`
+	// Meter shows the progress of the track on the LED meter
+	Meter bool `toml:"meter"`
+}
+
+type VuMeterConfig struct {
+	// Enabled shows the level of the default sink on the LED meter while playing
+	Enabled bool `toml:"enabled"`
+	// FrameRate is the number of meter updates per second
+	FrameRate int `toml:"frame_rate"`
+	// Decay is the fall of the level after a peak, in dB per second
+	Decay float64 `toml:"decay"`
+	// PeakHold is the time a peak is held before it decays, in seconds
+	PeakHold float64 `toml:"peak_hold"`
+}
+
+// ControlConfig configures the interfaces through which other programs control the controller
+type ControlConfig struct {
+	// Socket is the path of the control socket, the socket is disabled when it is empty
+	Socket string `toml:"socket"`
+	// Dbus exports the state of the controller as a service on the session bus
+	Dbus bool `toml:"dbus"`
+}
+
+type HttpConfig struct {
+	// Enabled starts the HTTP server
+	Enabled bool `toml:"enabled"`
+	// Listen is the address of the HTTP server
+	Listen string `toml:"listen"`
+}
+
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "midi-media-controller", "config.toml")
+}
+
+// DefaultControlSocketPath returns the path of the control socket in the runtime directory of the user
+func DefaultControlSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if len(dir) == 0 {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("midi-media-controller-%d.sock", os.Getuid()))
+	}
+
+	return filepath.Join(dir, "midi-media-controller.sock")
+}
+
+// DefaultLastPlayerPath returns the file in which the last selected player is remembered between restarts
+func DefaultLastPlayerPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if len(dir) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(dir, "midi-media-controller", "last-player")
+}
+
+// LoadConfig reads the configuration file at path. When optional is set, a missing file results in the default
+// configuration instead of an error. Bindings are left empty when the file has none, so the defaults of the
+// controller profile can be used.
+func LoadConfig(path string, optional bool) (*Config, error) {
+	config := &Config{
+		Players: PlayersConfig{Follow: true, Order: playerOrderRegistration, Remember: true, Proxy: true},
+		Mixer:   MixerConfig{Curve: volumeCurveCubic, DbFloor: -60},
+		Calls: CallsConfig{
+			Applications: []string{"zoom", "teams", "teams-for-linux", "skype", "Discord", "slack", "Mumble",
+				"WEBRTC VoiceEngine"},
+		},
+		Seek:    SeekConfig{Step: 5, Acceleration: 0.5, MaxStep: 60},
+		VuMeter: VuMeterConfig{FrameRate: 30, Decay: 20, PeakHold: 0.5},
+		Control: ControlConfig{Socket: DefaultControlSocketPath(), Dbus: true},
+		Http:    HttpConfig{Listen: "localhost:8765"},
+	}
+
+	if len(path) != 0 {
+		metadata, err := toml.DecodeFile(path, config)
+		if err != nil && !(optional && os.IsNotExist(err)) {
+			return nil, fmt.Errorf("error while reading config %s: %v", path, err)
+		}
+
+		if undecoded := metadata.Undecoded(); len(undecoded) != 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return nil, fmt.Errorf("unknown key(s) in config %s: %s", path, strings.Join(keys, ", "))
+		}
+	}
+
+	switch config.Players.Order {
+	case playerOrderRegistration, playerOrderAlphabetical, playerOrderPriority:
+	default:
+		return nil, fmt.Errorf("invalid players config in %s: unknown order %q, expected registration, alphabetical "+
+			"or priority", path, config.Players.Order)
+	}
+
+	if config.Seek.Step <= 0 || config.Seek.Acceleration < 0 || config.Seek.MaxStep < config.Seek.Step {
+		return nil, fmt.Errorf("invalid seek config in %s: step must be positive, acceleration not negative and "+
+			"max_step at least step", path)
+	}
+
+	if config.VuMeter.FrameRate <= 0 || config.VuMeter.FrameRate > 100 || config.VuMeter.Decay < 0 || config.VuMeter.PeakHold < 0 {
+		return nil, fmt.Errorf("invalid vu_meter config in %s: frame_rate must be between 1 and 100, decay and "+
+			"peak_hold not negative", path)
+	}
+
+	if config.VuMeter.Enabled && config.Progress.Meter {
+		return nil, fmt.Errorf("invalid config in %s: vu_meter and progress.meter both use the LED meter", path)
+	}
+
+	if len(config.Device.Profile) == 0 {
+		config.Device.Profile = defaultControllerProfile
+	}
+
+	return config, nil
+}
+
+// DefaultBindings returns the bindings which ship with the given controller profile
+func DefaultBindings(profile string) ([]BindingConfig, error) {
+	bindings := struct {
+		Bindings []BindingConfig `toml:"binding"`
+	}{}
+
+	data, err := profileBindings.ReadFile("profiles/" + profile + ".toml")
+	if err != nil {
+		return nil, fmt.Errorf("no default bindings for profile %s", profile)
+	}
+
+	_, err = toml.Decode(string(data), &bindings)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading default bindings of profile %s: %v", profile, err)
+	}
+
+	return bindings.Bindings, nil
+}
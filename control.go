@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ControlRequest is a command of the control protocol, like {"command": "select", "player": "spotify"}
+type ControlRequest struct {
+	Command string `json:"command"`
+	// Action, Args and Value are the action to run with the action command, Value is needed by controls
+	Action string   `json:"action,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	Value  *uint8   `json:"value,omitempty"`
+	// Player is the identity or bus name of the player to select
+	Player string `json:"player,omitempty"`
+	// Mode is the display or segment display mode
+	Mode string `json:"mode,omitempty"`
+	// Text, Color and Seconds are the message to show on the LCD
+	Text    string  `json:"text,omitempty"`
+	Color   string  `json:"color,omitempty"`
+	Seconds float64 `json:"seconds,omitempty"`
+}
+
+type ControlResponse struct {
+	OK    bool          `json:"ok"`
+	Error string        `json:"error,omitempty"`
+	State *ControlState `json:"state,omitempty"`
+}
+
+// ControlState is the state of the controller returned by the state command
+type ControlState struct {
+	Player             string   `json:"player"`
+	Players            []string `json:"players"`
+	Locked             bool     `json:"locked"`
+	PlaybackStatus     string   `json:"playback_status"`
+	Artist             string   `json:"artist"`
+	Title              string   `json:"title"`
+	Album              string   `json:"album"`
+	Position           float64  `json:"position"`
+	Length             float64  `json:"length"`
+	DisplayMode        string   `json:"display_mode"`
+	SegmentDisplayMode string   `json:"segment_display_mode"`
+	SeekMode           bool     `json:"seek_mode"`
+	Volume             float32  `json:"volume"`
+	SinkMuted          bool     `json:"sink_muted"`
+	SourceMuted        bool     `json:"source_muted"`
+	MicMuted           bool     `json:"mic_muted"`
+}
+
+// controlShortcuts are commands which run an action without arguments
+var controlShortcuts = map[string]string{
+	"previous":   "player.previous",
+	"prev":       "player.previous",
+	"next":       "player.next",
+	"stop":       "player.stop",
+	"play":       "player.play",
+	"pause":      "player.pause",
+	"play-pause": "player.play-pause",
+}
+
+var colorNames = map[string]uint8{
+	"black":   ColorBlack,
+	"red":     ColorRed,
+	"green":   ColorGreen,
+	"yellow":  ColorYellow,
+	"blue":    ColorBlue,
+	"magenta": ColorMagenta,
+	"cyan":    ColorCyan,
+	"white":   ColorWhite,
+}
+
+// ControlHandler runs the commands of the control protocol and publishes the state of the controller, its methods may
+// be called from any goroutine
+type ControlHandler interface {
+	HandleControlRequest(request ControlRequest) ControlResponse
+	// AddControlStateCallback calls callback with the current state, and again after every event which may have
+	// changed it
+	AddControlStateCallback(callback func(state *ControlState))
+}
+
+// HandleControlRequest runs a command of the control protocol on the event loop, it may be called from any goroutine
+func (h *EventHandler) HandleControlRequest(request ControlRequest) ControlResponse {
+	var response ControlResponse
+	if !h.call(func() {
+		response = h.control(request)
+	}) {
+		return ControlResponse{Error: "the controller is shutting down"}
+	}
+
+	return response
+}
+
+// AddControlStateCallback calls callback on the event loop with the current state, and after every event which may have
+// changed it. It may be called from any goroutine.
+func (h *EventHandler) AddControlStateCallback(callback func(state *ControlState)) {
+	h.call(func() {
+		callback(h.controlState())
+		h.AddStateChangeCallback(func() {
+			callback(h.controlState())
+		})
+	})
+}
+
+func (h *EventHandler) control(request ControlRequest) ControlResponse {
+	var err error
+
+	switch request.Command {
+	case "action":
+		err = h.controlAction(request.Action, request.Args, request.Value)
+	case "select":
+		if !h.monitor.SelectPlayerByName(request.Player) {
+			err = fmt.Errorf("no player %q", request.Player)
+		}
+	case "display":
+		var mode int
+		mode, err = parseMode(request.Mode, displayModeNames)
+		if err == nil {
+			h.SetDisplayMode(mode)
+		}
+	case "segment":
+		var mode int
+		mode, err = parseMode(request.Mode, segmentDisplayModeNames)
+		if err == nil {
+			h.SetSegmentDisplayMode(mode)
+		}
+	case "message":
+		err = h.controlMessage(request.Text, request.Color, request.Seconds)
+	case "state":
+		return ControlResponse{OK: true, State: h.controlState()}
+	default:
+		action, ok := controlShortcuts[request.Command]
+		if !ok {
+			err = fmt.Errorf("unknown command %q", request.Command)
+			break
+		}
+		err = h.controlAction(action, nil, nil)
+	}
+
+	if err != nil {
+		return ControlResponse{Error: err.Error()}
+	}
+
+	return ControlResponse{OK: true}
+}
+
+// controlAction runs an action like a binding would. Buttons are pressed with the value 127 when it is not given,
+// touch and control actions need a value.
+func (h *EventHandler) controlAction(action string, args []string, value *uint8) error {
+	definition, ok := actions[action]
+	if !ok {
+		return fmt.Errorf("unknown action %q, expected one of %s", action, strings.Join(actionNames(), ", "))
+	}
+
+	err := validateActionArgs(action, definition, args)
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		if definition.kind != actionButton {
+			return fmt.Errorf("action %s needs a value", action)
+		}
+		pressed := uint8(127)
+		value = &pressed
+	}
+	if *value > 127 {
+		return fmt.Errorf("value %d is out of range 0-127", *value)
+	}
+
+	definition.handler(h, args, *value)
+
+	return nil
+}
+
+func (h *EventHandler) controlMessage(text string, colorName string, seconds float64) error {
+	color := ColorWhite
+	if len(colorName) != 0 {
+		var ok bool
+		color, ok = colorNames[strings.ToLower(colorName)]
+		if !ok {
+			return fmt.Errorf("unknown color %q, expected one of %s", colorName,
+				strings.Join(sortedKeys(colorNames), ", "))
+		}
+	}
+
+	duration := textOverlayDuration
+	if seconds < 0 {
+		return fmt.Errorf("seconds must not be negative")
+	}
+	if seconds > 0 {
+		duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	h.ShowMessage(text, duration, color)
+
+	return nil
+}
+
+func (h *EventHandler) controlState() *ControlState {
+	state := &ControlState{
+		Players:            []string{},
+		Locked:             h.monitor.Locked(),
+		PlaybackStatus:     h.playbackStatus,
+		Position:           h.trackPosition().Seconds(),
+		Length:             h.trackLength().Seconds(),
+		DisplayMode:        displayModeNames[h.displayMode],
+		SegmentDisplayMode: segmentDisplayModeNames[h.segmentDisplayMode],
+		SeekMode:           h.seekMode,
+		Volume:             h.mixer.volume,
+		SinkMuted:          h.sinkMuted,
+		SourceMuted:        h.sourceMuted,
+		MicMuted:           h.micMuted,
+	}
+
+	if h.player != nil {
+		state.Player = h.player.name
+	}
+	for _, player := range h.monitor.Players() {
+		state.Players = append(state.Players, player.name)
+	}
+	if h.track != nil {
+		state.Artist = h.track.artist
+		state.Title = h.track.title
+		state.Album = h.track.album
+	}
+
+	return state
+}
+
+func parseMode(name string, names []string) (int, error) {
+	for i, mode := range names {
+		if mode == name {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown mode %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+func sortedKeys(m map[string]uint8) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ControlServer accepts commands of the control protocol on a Unix socket. Every line is a JSON request, which is
+// answered by a line with a JSON response.
+type ControlServer struct {
+	path     string
+	handler  ControlHandler
+	listener net.Listener
+}
+
+func NewControlServer(path string, handler ControlHandler) *ControlServer {
+	return &ControlServer{
+		path:    path,
+		handler: handler,
+	}
+}
+
+func (s *ControlServer) Start() error {
+	// a socket left behind by a daemon which did not exit cleanly is replaced, unless a daemon still listens on it
+	if conn, err := net.Dial("unix", s.path); err == nil {
+		conn.Close()
+		return fmt.Errorf("control socket %s is in use by another instance", s.path)
+	}
+	os.Remove(s.path)
+
+	err := os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return fmt.Errorf("error while creating control socket: %v", err)
+	}
+
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return fmt.Errorf("error while creating control socket: %v", err)
+	}
+
+	// the socket can run any command with the exec action, so only the user may connect
+	err = os.Chmod(s.path, 0600)
+	if err != nil {
+		listener.Close()
+		return fmt.Errorf("error while creating control socket: %v", err)
+	}
+
+	s.listener = listener
+	go s.accept()
+
+	return nil
+}
+
+// Close stops accepting connections and removes the socket
+func (s *ControlServer) Close() error {
+	return s.listener.Close()
+}
+
+func (s *ControlServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.serve(conn)
+	}
+}
+
+func (s *ControlServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var request ControlRequest
+		var response ControlResponse
+
+		err := json.Unmarshal(scanner.Bytes(), &request)
+		if err != nil {
+			response.Error = fmt.Sprintf("invalid request: %v", err)
+		} else {
+			response = s.handler.HandleControlRequest(request)
+		}
+
+		err = encoder.Encode(response)
+		if err != nil {
+			log.Printf("error while writing control response: %v", err)
+			return
+		}
+	}
+}
+
+const ctlUsage = `commands:
+  previous | next | stop | play | pause | play-pause
+  select <player>
+  display artist-title | artist | title | album
+  segment player | time | elapsed | remaining | total
+  message [-color <color>] [-seconds <seconds>] <text>
+  action [-value <0-127>] <action> [args...]
+  state`
+
+// RunCtl sends the command given by args to the daemon listening on the control socket at path, and writes the state
+// to output when it was queried
+func RunCtl(path string, args []string, output io.Writer) error {
+	request, err := parseCtlArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if len(path) == 0 {
+		return fmt.Errorf("the control socket is disabled")
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("error while connecting to the daemon: %v", err)
+	}
+	defer conn.Close()
+
+	err = json.NewEncoder(conn).Encode(request)
+	if err != nil {
+		return fmt.Errorf("error while sending command: %v", err)
+	}
+
+	var response ControlResponse
+	err = json.NewDecoder(conn).Decode(&response)
+	if err != nil {
+		return fmt.Errorf("error while reading response: %v", err)
+	}
+
+	if !response.OK {
+		return fmt.Errorf("%s", response.Error)
+	}
+
+	if response.State != nil {
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(response.State)
+	}
+
+	return nil
+}
+
+func parseCtlArgs(args []string) (ControlRequest, error) {
+	if len(args) == 0 {
+		return ControlRequest{}, fmt.Errorf("missing command, %s", ctlUsage)
+	}
+
+	request := ControlRequest{Command: args[0]}
+	args = args[1:]
+
+	switch request.Command {
+	case "select":
+		if len(args) != 1 {
+			return request, fmt.Errorf("usage: select <player>")
+		}
+		request.Player = args[0]
+	case "display", "segment":
+		if len(args) != 1 {
+			return request, fmt.Errorf("usage: %s <mode>", request.Command)
+		}
+		request.Mode = args[0]
+	case "message":
+		flags := flag.NewFlagSet("message", flag.ContinueOnError)
+		flags.StringVar(&request.Color, "color", "", "color of the text")
+		flags.Float64Var(&request.Seconds, "seconds", 0, "time the message is shown")
+		err := flags.Parse(args)
+		if err != nil {
+			return request, err
+		}
+		request.Text = strings.Join(flags.Args(), " ")
+	case "action":
+		flags := flag.NewFlagSet("action", flag.ContinueOnError)
+		value := flags.String("value", "", "value of a control action")
+		err := flags.Parse(args)
+		if err != nil {
+			return request, err
+		}
+		if flags.NArg() == 0 {
+			return request, fmt.Errorf("usage: action [-value <0-127>] <action> [args...]")
+		}
+		request.Action = flags.Arg(0)
+		request.Args = flags.Args()[1:]
+		if len(*value) != 0 {
+			parsed, err := strconv.ParseUint(*value, 10, 8)
+			if err != nil || parsed > 127 {
+				return request, fmt.Errorf("invalid value %q", *value)
+			}
+			v := uint8(parsed)
+			request.Value = &v
+		}
+	default:
+		if len(args) != 0 {
+			return request, fmt.Errorf("command %s takes no arguments", request.Command)
+		}
+	}
+
+	return request, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCtlArgs(t *testing.T) {
+	value := uint8Pointer
+
+	tests := []struct {
+		args    []string
+		request ControlRequest
+		// err is a part of the expected error, the arguments are valid when it is empty
+		err string
+	}{
+		{args: []string{"play-pause"}, request: ControlRequest{Command: "play-pause"}},
+		{args: []string{"state"}, request: ControlRequest{Command: "state"}},
+		{args: []string{"select", "spotify"}, request: ControlRequest{Command: "select", Player: "spotify"}},
+		{args: []string{"display", "title"}, request: ControlRequest{Command: "display", Mode: "title"}},
+		{args: []string{"segment", "elapsed"}, request: ControlRequest{Command: "segment", Mode: "elapsed"}},
+		{
+			args:    []string{"message", "-color", "red", "-seconds", "2.5", "Hello", "world"},
+			request: ControlRequest{Command: "message", Text: "Hello world", Color: "red", Seconds: 2.5},
+		},
+		{args: []string{"message", "Hello"}, request: ControlRequest{Command: "message", Text: "Hello"}},
+		{
+			args:    []string{"action", "mixer.mute", "sink", "source"},
+			request: ControlRequest{Command: "action", Action: "mixer.mute", Args: []string{"sink", "source"}},
+		},
+		{
+			args:    []string{"action", "-value", "127", "mixer.volume"},
+			request: ControlRequest{Command: "action", Action: "mixer.volume", Args: []string{}, Value: value(127)},
+		},
+		{args: nil, err: "missing command"},
+		{args: []string{"select"}, err: "usage: select <player>"},
+		{args: []string{"select", "vlc", "spotify"}, err: "usage: select <player>"},
+		{args: []string{"display"}, err: "usage: display <mode>"},
+		{args: []string{"message", "-size", "2", "Hello"}, err: "flag provided but not defined: -size"},
+		{args: []string{"action"}, err: "usage: action"},
+		{args: []string{"action", "-value", "128", "mixer.volume"}, err: `invalid value "128"`},
+		{args: []string{"action", "-value", "loud", "mixer.volume"}, err: `invalid value "loud"`},
+		{args: []string{"next", "now"}, err: "command next takes no arguments"},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			request, err := parseCtlArgs(test.args)
+
+			if len(test.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(request, test.request) {
+				t.Errorf("expected request %+v, got %+v", test.request, request)
+			}
+		})
+	}
+}
+
+func TestRunCtl(t *testing.T) {
+	handler := &fakeControlHandler{state: ControlState{Player: "spotify", Players: []string{"spotify"}}}
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	server := NewControlServer(path, handler)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var output bytes.Buffer
+	if err := RunCtl(path, []string{"select", "spotify"}, &output); err != nil {
+		t.Fatal(err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("expected no output, got %q", output.String())
+	}
+
+	if err := RunCtl(path, []string{"state"}, &output); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), `"player": "spotify"`) {
+		t.Errorf("expected the state to be written, got %q", output.String())
+	}
+
+	err := RunCtl(path, []string{"action", "player.rewind"}, &output)
+	if err == nil || err.Error() != "unknown action player.rewind" {
+		t.Errorf("expected the error of the daemon, got %v", err)
+	}
+
+	// invalid arguments are not sent to the daemon
+	if err := RunCtl(path, []string{"select"}, &output); err == nil {
+		t.Error("expected an error for invalid arguments")
+	}
+
+	expected := []ControlRequest{
+		{Command: "select", Player: "spotify"},
+		{Command: "state"},
+		{Command: "action", Action: "player.rewind"},
+	}
+	handler.mutex.Lock()
+	requests := handler.requests
+	handler.mutex.Unlock()
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected requests %+v, got %+v", expected, requests)
+	}
+
+	if err := RunCtl("", []string{"state"}, &output); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("expected an error for a disabled socket, got %v", err)
+	}
+}
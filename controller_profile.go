@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/mid"
+	"sort"
+	"strings"
+)
+
+// ControllerProfile describes a MIDI control surface. Its buttons, faders and encoders are mapped to actions by the
+// bindings in profiles/<name>.toml; the outputs a device supports are exposed through the optional capability
+// interfaces below, which the MidiController checks before writing.
+type ControllerProfile interface {
+	Name() string
+	DefaultPort() string
+	Reset(w *mid.Writer) error
+}
+
+// ButtonLeds is implemented by profiles which can light the LEDs of their buttons
+type ButtonLeds interface {
+	SetNoteLed(w *mid.Writer, note uint8, on bool) error
+	SetControlLed(w *mid.Writer, controller uint8, on bool) error
+}
+
+// MotorFader is implemented by profiles with motorized faders which can be moved to a value
+type MotorFader interface {
+	SetFader(w *mid.Writer, controller uint8, value uint8) error
+}
+
+// LedRing is implemented by profiles which can show the position of an encoder on a LED ring
+type LedRing interface {
+	SetLedRing(w *mid.Writer, controller uint8, value uint8) error
+}
+
+// LedMeter is implemented by profiles with a level meter
+type LedMeter interface {
+	SetLedMeter(w *mid.Writer, value uint8) error
+}
+
+// TextDisplay is implemented by profiles with a character display
+type TextDisplay interface {
+	TextSize() (columns int, rows int)
+	ShowText(w *mid.Writer, text string, color uint8, invert uint8) error
+}
+
+// SegmentDisplay is implemented by profiles with a 7-segment display
+type SegmentDisplay interface {
+	SegmentDigits() int
+	ShowSegments(w *mid.Writer, data SegmentDisplayData) error
+}
+
+// ModeSelector is implemented by profiles of devices which speak more than one protocol
+type ModeSelector interface {
+	SetMode(mode string) error
+}
+
+// ModeDetector is implemented by profiles which detect the protocol of the device from the messages it sends
+type ModeDetector interface {
+	// DetectMode returns true when the message revealed a different protocol, after which the device is reset
+	DetectMode(msg midi.Message) bool
+	// ResetDetection starts a new detection, as the device may have been switched to another protocol while it was
+	// disconnected
+	ResetDetection()
+}
+
+// InputTranslator is implemented by profiles of devices which do not send plain notes and control changes
+type InputTranslator interface {
+	// TranslateInput converts a message to the notes and control changes used by the bindings, or returns nil when
+	// the message should be ignored
+	TranslateInput(msg midi.Message) midi.Message
+}
+
+// controllerProfiles create the profiles by name, a profile may hold the state of the device so every controller gets
+// its own
+var controllerProfiles = map[string]func() ControllerProfile{
+	"x-touch-one":  func() ControllerProfile { return &xTouchOne{mode: xTouchOneModeAuto} },
+	"x-touch-mini": func() ControllerProfile { return &xTouchMini{} },
+	"nanokontrol2": func() ControllerProfile { return &nanoKontrol2{} },
+	"lpd8":         func() ControllerProfile { return &lpd8{} },
+}
+
+const defaultControllerProfile = "x-touch-one"
+
+// GetControllerProfile returns a new profile with the given name
+func GetControllerProfile(name string) (ControllerProfile, error) {
+	newProfile, ok := controllerProfiles[name]
+	if !ok {
+		names := make([]string, 0, len(controllerProfiles))
+		for name := range controllerProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("unknown controller profile %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+
+	return newProfile(), nil
+}
+
+func resetNoteLeds(w *mid.Writer, from uint8, to uint8) error {
+	for n := from; n <= to; n++ {
+		err := w.NoteOn(n, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ledVelocity(on bool) uint8 {
+	if on {
+		return 127
+	}
+
+	return 0
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"gitlab.com/gomidi/midi/mid"
+	"strings"
+	"testing"
+)
+
+func TestGetControllerProfile(t *testing.T) {
+	for name := range controllerProfiles {
+		profile, err := GetControllerProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if profile.Name() != name {
+			t.Errorf("expected profile %s, got %s", name, profile.Name())
+		}
+	}
+
+	_, err := GetControllerProfile("x-touch-two")
+	if err == nil || !strings.Contains(err.Error(), `unknown controller profile "x-touch-two"`) {
+		t.Errorf("expected an unknown profile error, got %v", err)
+	}
+}
+
+func TestGetControllerProfileNotShared(t *testing.T) {
+	first, err := GetControllerProfile("x-touch-one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.(ModeSelector).SetMode(xTouchOneModeMcu); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := GetControllerProfile("x-touch-one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatal("expected a new profile on every call")
+	}
+	if second.(*xTouchOne).mode != xTouchOneModeAuto {
+		t.Errorf("expected mode %s of a new profile, got %s", xTouchOneModeAuto, second.(*xTouchOne).mode)
+	}
+}
+
+// failingMidiOut is an output port on which sending fails after a number of messages
+type failingMidiOut struct {
+	virtualPort
+	sent      int
+	failAfter int
+}
+
+func (p *failingMidiOut) Send(data []byte) error {
+	if p.failAfter >= 0 && p.sent >= p.failAfter {
+		return errors.New("device is gone")
+	}
+	p.sent++
+
+	return nil
+}
+
+// testResetErrors checks that the reset of the profile fails when any of its messages cannot be sent, so the
+// controller notices that the device is gone
+func testResetErrors(t *testing.T, profile ControllerProfile) {
+	reset := func(failAfter int) (int, error) {
+		out := &failingMidiOut{failAfter: failAfter}
+		out.Open()
+		writer := mid.ConnectOut(out)
+		writer.ConsolidateNotes(false)
+
+		err := profile.Reset(writer)
+
+		return out.sent, err
+	}
+
+	total, err := reset(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for failAfter := 0; failAfter < total; failAfter++ {
+		if _, err := reset(failAfter); err == nil {
+			t.Errorf("expected an error when sending fails after %d of %d messages", failAfter, total)
+		}
+	}
+}
+
+func TestControllerProfileResetError(t *testing.T) {
+	profiles := map[string]ControllerProfile{
+		"x-touch-one standard": &xTouchOne{mode: xTouchOneModeStandard},
+		"x-touch-one auto":     &xTouchOne{mode: xTouchOneModeAuto},
+		"x-touch-mini":         &xTouchMini{},
+		"nanokontrol2":         &nanoKontrol2{},
+	}
+
+	for name, profile := range profiles {
+		t.Run(name, func(t *testing.T) {
+			testResetErrors(t, profile)
+		})
+	}
+}
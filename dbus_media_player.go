@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/godbus/dbus"
 	"strings"
+	"time"
 )
 
 const (
@@ -10,13 +11,18 @@ const (
 	mprisName       = "org.mpris.MediaPlayer2"
 	mprisPlayerName = "org.mpris.MediaPlayer2.Player"
 
-	propertiesGet = "org.freedesktop.DBus.Properties.Get"
+	propertiesGet    = "org.freedesktop.DBus.Properties.Get"
+	getConnectionPid = "org.freedesktop.DBus.GetConnectionUnixProcessID"
 
 	stop      = mprisPlayerName + ".Stop"
 	play      = mprisPlayerName + ".Play"
+	pause     = mprisPlayerName + ".Pause"
 	playPause = mprisPlayerName + ".PlayPause"
 	previous  = mprisPlayerName + ".Previous"
 	next      = mprisPlayerName + ".Next"
+	seek      = mprisPlayerName + ".Seek"
+	setPos    = mprisPlayerName + ".SetPosition"
+	openUri   = mprisPlayerName + ".OpenUri"
 )
 
 type DbusMediaPlayer struct {
@@ -25,14 +31,22 @@ type DbusMediaPlayer struct {
 	owner                     string
 	name                      string
 	nameLower                 string
+	pid                       int
+	registration              int
 	mprisObj                  dbus.BusObject
 	playbackStatus            string
 	track                     Track
+	metadata                  map[string]dbus.Variant
+	position                  time.Duration
+	positionTime              time.Time
+	rate                      float64
 	propertiesChangedCallback func(playbackStatus string, track Track)
+	seekedCallback            func(position time.Duration)
 }
 
 func (p *DbusMediaPlayer) Init() {
 	p.mprisObj = p.bus.Object(p.busName, mprisPath)
+	p.rate = 1
 
 	p.name = p.busName
 
@@ -44,11 +58,31 @@ func (p *DbusMediaPlayer) Init() {
 	}
 	p.nameLower = strings.ToLower(p.name)
 
-	p.mprisObj.AddMatchSignal("org.freedesktop.DBus.Properties", "PropertiesChanged")
+	var pid uint32
+	err := p.bus.BusObject().Call(getConnectionPid, 0, p.busName).Store(&pid)
+	if err == nil {
+		p.pid = int(pid)
+	}
+}
+
+// Matches returns true when the identity of the player, or its bus name without the MPRIS prefix and instance
+// suffix, is one of the given names, ignoring case
+func (p *DbusMediaPlayer) Matches(names []string) bool {
+	shortName := p.shortName()
+
+	for _, name := range names {
+		if strings.EqualFold(name, p.name) || strings.EqualFold(name, shortName) {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (p *DbusMediaPlayer) Close() {
-	p.mprisObj.RemoveMatchSignal("org.freedesktop.DBus.Properties", "PropertiesChanged")
+// shortName returns the bus name without the MPRIS prefix and instance suffix, like chromium for
+// org.mpris.MediaPlayer2.chromium.instance1234
+func (p *DbusMediaPlayer) shortName() string {
+	return strings.SplitN(strings.TrimPrefix(p.busName, mediaPlayerPrefix), ".", 2)[0]
 }
 
 func (p *DbusMediaPlayer) Stop() {
@@ -59,6 +93,10 @@ func (p *DbusMediaPlayer) Play() {
 	p.mprisObj.Call(play, 0).Store()
 }
 
+func (p *DbusMediaPlayer) Pause() {
+	p.mprisObj.Call(pause, 0).Store()
+}
+
 func (p *DbusMediaPlayer) PlayPause() {
 	p.mprisObj.Call(playPause, 0).Store()
 }
@@ -71,26 +109,100 @@ func (p *DbusMediaPlayer) Next() {
 	p.mprisObj.Call(next, 0).Store()
 }
 
+// Seek moves the playback position by offset, which may be negative. The player seeks asynchronously, so the known
+// position is moved by offset until the Seeked signal tells the actual position.
+func (p *DbusMediaPlayer) Seek(offset time.Duration) {
+	p.mprisObj.Call(seek, 0, int64(offset/time.Microsecond)).Store()
+	p.setPosition(p.Position() + offset)
+}
+
+// SetPosition moves the playback position of the given track to position
+func (p *DbusMediaPlayer) SetPosition(trackID dbus.ObjectPath, position time.Duration) {
+	p.mprisObj.Call(setPos, 0, trackID, int64(position/time.Microsecond)).Store()
+}
+
+func (p *DbusMediaPlayer) OpenUri(uri string) {
+	p.mprisObj.Call(openUri, 0, uri).Store()
+}
+
+// FetchPosition asks the player for its position, which is then extrapolated by Position
+func (p *DbusMediaPlayer) FetchPosition() time.Duration {
+	var position int64
+	p.mprisObj.Call(propertiesGet, 0, mprisPlayerName, "Position").Store(&position)
+	p.setPosition(time.Duration(position) * time.Microsecond)
+
+	return p.position
+}
+
+// Position returns the playback position, extrapolated from the last known position with the playback rate. The
+// player does not signal position changes during playback, so this avoids polling it.
+func (p *DbusMediaPlayer) Position() time.Duration {
+	position := p.position
+	if p.playbackStatus == "Playing" {
+		position += time.Duration(float64(time.Since(p.positionTime)) * p.rate)
+	}
+
+	if position < 0 {
+		return 0
+	}
+	if p.track.length > 0 && position > p.track.length {
+		return p.track.length
+	}
+
+	return position
+}
+
+func (p *DbusMediaPlayer) setPosition(position time.Duration) {
+	p.position = position
+	p.positionTime = time.Now()
+}
+
+func (p *DbusMediaPlayer) FetchPlaybackStatus() string {
+	p.mprisObj.Call(propertiesGet, 0, mprisPlayerName, "PlaybackStatus").Store(&p.playbackStatus)
+
+	return p.playbackStatus
+}
+
 func (p *DbusMediaPlayer) FetchProperties() (string, Track) {
 	p.mprisObj.Call(propertiesGet, 0, mprisPlayerName, "PlaybackStatus").Store(&p.playbackStatus)
 
 	var metadataVariant map[string]dbus.Variant
 	p.mprisObj.Call(propertiesGet, 0, mprisPlayerName, "Metadata").Store(&metadataVariant)
+	p.metadata = metadataVariant
 	p.track = parseMetadata(metadataVariant)
 
+	p.rate = 1
+	p.mprisObj.Call(propertiesGet, 0, mprisPlayerName, "Rate").Store(&p.rate)
+	p.FetchPosition()
+
 	return p.playbackStatus, p.track
 }
 
 func (p *DbusMediaPlayer) onPropertiesChanged(propertiesVariant map[string]dbus.Variant) {
+	// the position is extrapolated up to now with the old status and rate, before they change
+	p.setPosition(p.Position())
+
 	if variant, found := propertiesVariant["PlaybackStatus"]; found {
 		if val, ok := variant.Value().(string); ok {
 			p.playbackStatus = val
 		}
 	}
 
+	if variant, found := propertiesVariant["Rate"]; found {
+		if val, ok := variant.Value().(float64); ok {
+			p.rate = val
+		}
+	}
+
 	if variant, found := propertiesVariant["Metadata"]; found {
 		if metadata, ok := variant.Value().(map[string]dbus.Variant); ok {
-			p.track = parseMetadata(metadata)
+			p.metadata = metadata
+			track := parseMetadata(metadata)
+			newTrack := track.isDifferent(&p.track)
+			p.track = track
+			if newTrack {
+				p.FetchPosition()
+			}
 		}
 	}
 
@@ -99,6 +211,18 @@ func (p *DbusMediaPlayer) onPropertiesChanged(propertiesVariant map[string]dbus.
 	}
 }
 
+func (p *DbusMediaPlayer) onSeeked(position int64) {
+	p.setPosition(time.Duration(position) * time.Microsecond)
+
+	if p.seekedCallback != nil {
+		p.seekedCallback(time.Duration(position) * time.Microsecond)
+	}
+}
+
+func (p *DbusMediaPlayer) SetOnSeekedHandler(callback func(position time.Duration)) {
+	p.seekedCallback = callback
+}
+
 func (p *DbusMediaPlayer) SetOnPropertiesChangedHandler(callback func(playbackStatus string, track Track)) {
 	p.propertiesChangedCallback = callback
 }
@@ -110,6 +234,7 @@ func parseMetadata(metadata map[string]dbus.Variant) Track {
 		album:       getMetaOrEmptyString(metadata, "xesam:album"),
 		title:       getMetaOrEmptyString(metadata, "xesam:title"),
 		trackNumber: getMetaOrZero(metadata, "xesam:trackNumber"),
+		length:      time.Duration(getMetaInt64OrZero(metadata, "mpris:length")) * time.Microsecond,
 	}
 }
 
@@ -133,6 +258,24 @@ func getMetaOrZero(metadata map[string]dbus.Variant, key string) int {
 	return 0
 }
 
+// getMetaInt64OrZero reads an integer of any size, as players differ in the type of mpris:length
+func getMetaInt64OrZero(metadata map[string]dbus.Variant, key string) int64 {
+	if variant, ok := metadata[key]; ok {
+		switch val := variant.Value().(type) {
+		case int64:
+			return val
+		case uint64:
+			return int64(val)
+		case int32:
+			return int64(val)
+		case uint32:
+			return int64(val)
+		}
+	}
+
+	return 0
+}
+
 func getMetaFirstOrEmptyString(metadata map[string]dbus.Variant, key string) string {
 	if variant, ok := metadata[key]; ok {
 		if val, ok := variant.Value().([]string); ok {
@@ -3,6 +3,9 @@ package main
 import (
 	"github.com/godbus/dbus"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -11,7 +14,17 @@ const (
 	listNames         = "org.freedesktop.DBus.ListNames"
 	getNameOwner      = "org.freedesktop.DBus.GetNameOwner"
 	nameOwnerChanged  = "org.freedesktop.DBus.NameOwnerChanged"
+	nameAcquired      = "org.freedesktop.DBus.NameAcquired"
+	nameLost          = "org.freedesktop.DBus.NameLost"
 	propertiesChanged = "org.freedesktop.DBus.Properties.PropertiesChanged"
+	propertiesIface   = "org.freedesktop.DBus.Properties"
+	seeked            = mprisPlayerName + ".Seeked"
+)
+
+const (
+	playerOrderRegistration = "registration"
+	playerOrderAlphabetical = "alphabetical"
+	playerOrderPriority     = "priority"
 )
 
 type DbusMediaPlayerMonitor struct {
@@ -20,11 +33,30 @@ type DbusMediaPlayerMonitor struct {
 	playerList                  map[string]*DbusMediaPlayer
 	signal                      chan *dbus.Signal
 	activePlayerChangedCallback func(player *DbusMediaPlayer)
+
+	// followPlaying makes the player which starts playing the active player, unless the selection is locked
+	followPlaying bool
+	locked        bool
+
+	// exclusive pauses the other players when a player starts playing, except the exempt players
+	exclusive       bool
+	exclusiveExempt []string
+
+	// order is the order in which the players are selected, priority the players by identity or bus name for the
+	// priority order
+	order         string
+	priority      []string
+	registrations int
+
+	// lastPlayerPath is the file in which the last selected player is remembered, rememberedPlayer its contents
+	lastPlayerPath   string
+	rememberedPlayer string
 }
 
 func NewDbusMediaPlayerMonitor(bus *dbus.Conn) *DbusMediaPlayerMonitor {
 	return &DbusMediaPlayerMonitor{
-		bus: bus,
+		bus:           bus,
+		followPlaying: true,
 	}
 }
 
@@ -54,17 +86,29 @@ func (m *DbusMediaPlayerMonitor) Init() error {
 	m.signal = make(chan *dbus.Signal, 10)
 
 	m.bus.AddMatchSignal(dbus.WithMatchMember("NameOwnerChanged"))
+	// a single match for the properties of all players, so a player which starts playing is noticed even when it is
+	// not the active one
+	m.bus.AddMatchSignal(
+		dbus.WithMatchObjectPath(mprisPath),
+		dbus.WithMatchInterface(propertiesIface),
+		dbus.WithMatchMember("PropertiesChanged"),
+		dbus.WithMatchArg(0, mprisPlayerName),
+	)
+	m.bus.AddMatchSignal(
+		dbus.WithMatchObjectPath(mprisPath),
+		dbus.WithMatchInterface(mprisPlayerName),
+		dbus.WithMatchMember("Seeked"),
+	)
 	m.bus.Signal(m.signal)
 
-	go func() {
-		for signal := range m.signal {
-			m.handleSignal(signal)
-		}
-	}()
-
 	return nil
 }
 
+// Signals returns the channel of D-Bus signals, which have to be passed to HandleSignal by the event loop
+func (m *DbusMediaPlayerMonitor) Signals() <-chan *dbus.Signal {
+	return m.signal
+}
+
 func (m *DbusMediaPlayerMonitor) GetActivePlayer() *DbusMediaPlayer {
 	if m.activePlayer == nil {
 		return nil
@@ -73,12 +117,19 @@ func (m *DbusMediaPlayerMonitor) GetActivePlayer() *DbusMediaPlayer {
 	return m.playerList[*m.activePlayer]
 }
 
-func (m *DbusMediaPlayerMonitor) handleSignal(signal *dbus.Signal) {
+// HandleSignal updates the players with a signal received from Signals
+func (m *DbusMediaPlayerMonitor) HandleSignal(signal *dbus.Signal) {
 	switch signal.Name {
 	case nameOwnerChanged:
 		m.onNameOwnerChanged(signal.Body[0].(string), signal.Body[1].(string), signal.Body[2].(string))
 	case propertiesChanged:
 		m.onPropertiesChanged(signal.Sender, signal.Body[1].(map[string]dbus.Variant))
+	case seeked:
+		if position, ok := signal.Body[0].(int64); ok {
+			m.onSeeked(signal.Sender, position)
+		}
+	case nameAcquired, nameLost:
+		// sent for the names of the services exported by this daemon
 	default:
 		log.Printf("Received unknown signal: %+v", signal)
 	}
@@ -105,23 +156,95 @@ func (m *DbusMediaPlayerMonitor) onPropertiesChanged(sender string, properties m
 		return
 	}
 
+	previousStatus := player.playbackStatus
 	player.onPropertiesChanged(properties)
+
+	if previousStatus != "Playing" && player.playbackStatus == "Playing" {
+		m.pauseOtherPlayers(player)
+		m.followPlayer(sender)
+	}
+}
+
+// pauseOtherPlayers pauses all other playing players when exclusive playback is enabled
+func (m *DbusMediaPlayerMonitor) pauseOtherPlayers(player *DbusMediaPlayer) {
+	if !m.exclusive || player.Matches(m.exclusiveExempt) {
+		return
+	}
+
+	for _, other := range m.playerList {
+		if other != player && other.playbackStatus == "Playing" && !other.Matches(m.exclusiveExempt) {
+			log.Printf("Pausing player %s as %s started playing", other.busName, player.busName)
+			other.Pause()
+		}
+	}
+}
+
+func (m *DbusMediaPlayerMonitor) onSeeked(sender string, position int64) {
+	if player, ok := m.playerList[sender]; ok {
+		player.onSeeked(position)
+	}
+}
+
+// followPlayer makes the player which started playing the active player, like playerctld does
+func (m *DbusMediaPlayerMonitor) followPlayer(ownerName string) {
+	if !m.followPlaying || m.locked || m.activePlayer == nil || *m.activePlayer == ownerName {
+		return
+	}
+
+	player, ok := m.playerList[ownerName]
+	if !ok {
+		return
+	}
+
+	log.Printf("Following player %s which started playing", player.busName)
+
+	m.setActivePlayer(ownerName, false)
+}
+
+// setActivePlayer makes the player with the given owner the active player. A player selected by the user is
+// remembered, unlike a player which became active by itself: because it appeared first, started playing or replaced a
+// player which quit.
+func (m *DbusMediaPlayerMonitor) setActivePlayer(ownerName string, selected bool) {
+	player := m.playerList[ownerName]
+	m.activePlayer = &ownerName
+
+	if selected && len(m.lastPlayerPath) != 0 {
+		m.rememberedPlayer = player.shortName()
+		err := os.MkdirAll(filepath.Dir(m.lastPlayerPath), 0755)
+		if err == nil {
+			err = os.WriteFile(m.lastPlayerPath, []byte(m.rememberedPlayer+"\n"), 0644)
+		}
+		if err != nil {
+			log.Printf("error while remembering the selected player: %v", err)
+		}
+	}
+
+	if m.activePlayerChangedCallback != nil {
+		m.activePlayerChangedCallback(player)
+	}
 }
 
 func (m *DbusMediaPlayerMonitor) addPlayer(name string, ownerName string) {
+	// the proxy player exported by this daemon is not a player to control
+	if names := m.bus.Names(); len(names) != 0 && ownerName == names[0] {
+		return
+	}
+
 	log.Printf("Adding new player %s owner %s", name, ownerName)
 
-	player := DbusMediaPlayer{bus: m.bus, busName: name, owner: ownerName}
+	m.registrations++
+	player := DbusMediaPlayer{bus: m.bus, busName: name, owner: ownerName, registration: m.registrations}
 	player.Init()
+	player.FetchPlaybackStatus()
 
 	m.playerList[ownerName] = &player
 
-	if m.activePlayer == nil {
-		m.activePlayer = &ownerName
+	remembered := len(m.rememberedPlayer) != 0 && player.Matches([]string{m.rememberedPlayer})
 
-		if m.activePlayerChangedCallback != nil {
-			m.activePlayerChangedCallback(&player)
-		}
+	if m.activePlayer == nil || (remembered && !m.locked) {
+		m.setActivePlayer(ownerName, false)
+	} else if player.playbackStatus == "Playing" {
+		m.followPlayer(ownerName)
 	}
 }
 
@@ -135,10 +258,9 @@ func (m *DbusMediaPlayerMonitor) removePlayer(name string, ownerName string) {
 	}
 
 	if *m.activePlayer == ownerName {
-		m.SelectPlayer(-1)
+		m.selectPlayer(-1, false)
 	}
 
-	player.Close()
 	delete(m.playerList, ownerName)
 
 	if *m.activePlayer == ownerName {
@@ -171,26 +293,127 @@ func (m *DbusMediaPlayerMonitor) SetActivePlayerChangedCallback(callback func(pl
 	m.activePlayerChangedCallback = callback
 }
 
+// SetFollowPlaying sets whether a player which starts playing becomes the active player
+func (m *DbusMediaPlayerMonitor) SetFollowPlaying(follow bool) {
+	m.followPlaying = follow
+}
+
+// SetExclusivePlayback sets whether the other players are paused when a player starts playing. The exempt players,
+// given by identity or bus name, are never paused and do not pause others.
+func (m *DbusMediaPlayerMonitor) SetExclusivePlayback(exclusive bool, exempt []string) {
+	m.exclusive = exclusive
+	m.exclusiveExempt = exempt
+}
+
+// SetOrder sets the order in which the players are selected: by registration, alphabetical or by priority. The
+// players in the priority list are given by identity or bus name, other players follow them by registration.
+func (m *DbusMediaPlayerMonitor) SetOrder(order string, priority []string) {
+	m.order = order
+	m.priority = priority
+}
+
+// SetLastPlayerPath sets the file in which the selected player is remembered, which is selected again when it appears. It
+// has to be called before Init.
+func (m *DbusMediaPlayerMonitor) SetLastPlayerPath(path string) {
+	m.lastPlayerPath = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("error while reading the remembered player: %v", err)
+		}
+		return
+	}
+
+	m.rememberedPlayer = strings.TrimSpace(string(data))
+}
+
+// ToggleLock locks or unlocks the active player, so it is no longer replaced by a player which starts playing. The
+// player can still be selected manually.
+func (m *DbusMediaPlayerMonitor) ToggleLock() bool {
+	m.locked = !m.locked
+
+	return m.locked
+}
+
+func (m *DbusMediaPlayerMonitor) Locked() bool {
+	return m.locked
+}
+
+// SelectPlayer selects the player offset places from the active player
 func (m *DbusMediaPlayerMonitor) SelectPlayer(offset int) {
-	if len(m.playerList) < 2 {
+	m.selectPlayer(offset, true)
+}
+
+func (m *DbusMediaPlayerMonitor) selectPlayer(offset int, selected bool) {
+	if len(m.playerList) < 2 || m.activePlayer == nil {
 		return
 	}
 
-	var keyList []string
+	players := m.orderedPlayers()
 	current := -1
-	index := 0
-	for key := range m.playerList {
-		keyList = append(keyList, key)
-		if key == *m.activePlayer {
-			current = index
+	for i, player := range players {
+		if player.owner == *m.activePlayer {
+			current = i
 		}
-		index++
 	}
 
-	newIndex := (((current + offset) % index) + index) % index
-	m.activePlayer = &keyList[newIndex]
+	newIndex := (((current + offset) % len(players)) + len(players)) % len(players)
+	m.setActivePlayer(players[newIndex].owner, selected)
+}
 
-	if m.activePlayerChangedCallback != nil {
-		m.activePlayerChangedCallback(m.GetActivePlayer())
+// SelectPlayerByName selects the first player with the given identity or bus name, it returns false when there is no
+// such player
+func (m *DbusMediaPlayerMonitor) SelectPlayerByName(name string) bool {
+	for _, player := range m.orderedPlayers() {
+		if player.Matches([]string{name}) {
+			m.setActivePlayer(player.owner, true)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Players returns the players in the order in which they are selected
+func (m *DbusMediaPlayerMonitor) Players() []*DbusMediaPlayer {
+	return m.orderedPlayers()
+}
+
+func (m *DbusMediaPlayerMonitor) orderedPlayers() []*DbusMediaPlayer {
+	players := make([]*DbusMediaPlayer, 0, len(m.playerList))
+	for _, player := range m.playerList {
+		players = append(players, player)
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		a, b := players[i], players[j]
+
+		switch m.order {
+		case playerOrderAlphabetical:
+			if a.nameLower != b.nameLower {
+				return a.nameLower < b.nameLower
+			}
+		case playerOrderPriority:
+			if pa, pb := m.playerPriority(a), m.playerPriority(b); pa != pb {
+				return pa < pb
+			}
+		}
+
+		return a.registration < b.registration
+	})
+
+	return players
+}
+
+// playerPriority returns the position of the player in the priority list, or the length of the list when it is not
+// listed
+func (m *DbusMediaPlayerMonitor) playerPriority(player *DbusMediaPlayer) int {
+	for i, name := range m.priority {
+		if player.Matches([]string{name}) {
+			return i
+		}
 	}
+
+	return len(m.priority)
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestMonitor returns a monitor without a bus of which the first player is the active player
+func newTestMonitor(players ...*DbusMediaPlayer) *DbusMediaPlayerMonitor {
+	m := NewDbusMediaPlayerMonitor(nil)
+	m.playerList = map[string]*DbusMediaPlayer{}
+	for _, player := range players {
+		m.playerList[player.owner] = player
+	}
+	activePlayer := players[0].owner
+	m.activePlayer = &activePlayer
+
+	return m
+}
+
+func playerNames(players []*DbusMediaPlayer) []string {
+	var names []string
+	for _, player := range players {
+		names = append(names, player.name)
+	}
+
+	return names
+}
+
+func TestDbusMediaPlayerMonitorOrder(t *testing.T) {
+	tests := []struct {
+		order    string
+		priority []string
+		names    []string
+		// next is the player selected after the active player vlc
+		next string
+	}{
+		{order: playerOrderRegistration, names: []string{"vlc", "chromium", "spotify", "firefox"}, next: "chromium"},
+		{order: playerOrderAlphabetical, names: []string{"chromium", "firefox", "spotify", "vlc"}, next: "chromium"},
+		{
+			order:    playerOrderPriority,
+			priority: []string{"Spotify", "firefox"},
+			names:    []string{"spotify", "firefox", "vlc", "chromium"},
+			next:     "chromium",
+		},
+		{
+			order:    playerOrderPriority,
+			priority: []string{"chromium", "spotify", "firefox"},
+			names:    []string{"chromium", "spotify", "firefox", "vlc"},
+			next:     "chromium",
+		},
+	}
+
+	for _, test := range tests {
+		m := newTestMonitor(
+			newTestPlayer("vlc", ":1.1", 1),
+			newTestPlayer("chromium", ":1.2", 2),
+			newTestPlayer("spotify", ":1.3", 3),
+			newTestPlayer("firefox", ":1.4", 4),
+		)
+		m.SetOrder(test.order, test.priority)
+
+		if names := playerNames(m.Players()); !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s %v: expected players %v, got %v", test.order, test.priority, test.names, names)
+		}
+
+		m.SelectPlayer(1)
+		if name := m.GetActivePlayer().name; name != test.next {
+			t.Errorf("%s %v: expected the next player to be %s, got %s", test.order, test.priority, test.next, name)
+		}
+	}
+}
+
+func TestDbusMediaPlayerMonitorRememberPlayer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "midi-media-controller", "last-player")
+	readRemembered := func() string {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return ""
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(data)
+	}
+
+	m := newTestMonitor(
+		newTestPlayer("vlc", ":1.1", 1),
+		newTestPlayer("chromium.instance1234", ":1.2", 2),
+		newTestPlayer("spotify", ":1.3", 3),
+	)
+	m.SetLastPlayerPath(path)
+	if len(m.rememberedPlayer) != 0 {
+		t.Fatalf("expected no remembered player, got %q", m.rememberedPlayer)
+	}
+
+	// players which become active by themselves are not remembered
+	m.followPlayer(":1.3")
+	if name := m.GetActivePlayer().name; name != "spotify" {
+		t.Fatalf("expected spotify to be followed, got %s", name)
+	}
+	m.removePlayer(mediaPlayerPrefix+"spotify", ":1.3")
+	if name := m.GetActivePlayer().name; name != "chromium.instance1234" {
+		t.Fatalf("expected chromium to replace spotify, got %s", name)
+	}
+	if remembered := readRemembered(); len(remembered) != 0 {
+		t.Fatalf("expected no remembered player, got %q", remembered)
+	}
+
+	// players selected by the user are remembered without their instance
+	m.SelectPlayer(1)
+	if remembered := readRemembered(); remembered != "vlc\n" {
+		t.Errorf("expected vlc to be remembered, got %q", remembered)
+	}
+	if !m.SelectPlayerByName("chromium") {
+		t.Fatal("expected chromium to be selected")
+	}
+	if remembered := readRemembered(); remembered != "chromium\n" {
+		t.Errorf("expected chromium to be remembered, got %q", remembered)
+	}
+	if m.SelectPlayerByName("spotify") {
+		t.Error("expected spotify not to be found")
+	}
+
+	m = NewDbusMediaPlayerMonitor(nil)
+	m.SetLastPlayerPath(path)
+	if m.rememberedPlayer != "chromium" {
+		t.Errorf("expected chromium to be read as the remembered player, got %q", m.rememberedPlayer)
+	}
+}
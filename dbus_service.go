@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+	"reflect"
+)
+
+const (
+	serviceName  = "com.github.DemonTPx.MidiMediaController"
+	servicePath  = "/com/github/DemonTPx/MidiMediaController"
+	serviceIface = serviceName
+
+	errorInvalidArgs      = "org.freedesktop.DBus.Error.InvalidArgs"
+	errorUnknownInterface = "org.freedesktop.DBus.Error.UnknownInterface"
+	errorUnknownProperty  = "org.freedesktop.DBus.Error.UnknownProperty"
+	errorPropertyReadOnly = "org.freedesktop.DBus.Error.PropertyReadOnly"
+	errorFailed           = "org.freedesktop.DBus.Error.Failed"
+)
+
+// serviceProperties are the properties of the service, the writable ones are set with a command of the control
+// protocol
+var serviceProperties = []introspect.Property{
+	{Name: "ActivePlayer", Type: "s", Access: "readwrite"},
+	{Name: "Players", Type: "as", Access: "read"},
+	{Name: "PlaybackStatus", Type: "s", Access: "read"},
+	{Name: "DisplayMode", Type: "s", Access: "readwrite"},
+	{Name: "SegmentDisplayMode", Type: "s", Access: "readwrite"},
+}
+
+// DbusService exports the state of the controller on the session bus, so desktop tools can follow and change what the
+// controller shows. Changes of the properties are announced with PropertiesChanged.
+type DbusService struct {
+	bus     *dbus.Conn
+	handler *EventHandler
+	// properties are the values last announced, owned by the event loop
+	properties map[string]dbus.Variant
+}
+
+func NewDbusService(bus *dbus.Conn, handler *EventHandler) *DbusService {
+	return &DbusService{
+		bus:     bus,
+		handler: handler,
+	}
+}
+
+// Start exports the service and requests its name, the event loop has to be running
+func (s *DbusService) Start() error {
+	node := &introspect.Node{
+		Name: servicePath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			dbusPropertiesIntrospectData,
+			{
+				Name: serviceIface,
+				Methods: []introspect.Method{{
+					Name: "ShowMessage",
+					Args: []introspect.Arg{
+						{Name: "text", Type: "s", Direction: "in"},
+						{Name: "seconds", Type: "d", Direction: "in"},
+						{Name: "color", Type: "s", Direction: "in"},
+					},
+				}},
+				Properties: serviceProperties,
+			},
+		},
+	}
+
+	err := s.bus.Export(introspect.NewIntrospectable(node), servicePath, "org.freedesktop.DBus.Introspectable")
+	if err == nil {
+		err = s.bus.Export(dbusServiceProperties{s}, servicePath, propertiesIface)
+	}
+	if err == nil {
+		err = s.bus.Export(dbusServiceMethods{s}, servicePath, serviceIface)
+	}
+	if err != nil {
+		return fmt.Errorf("error while exporting the d-bus service: %v", err)
+	}
+
+	s.handler.call(func() {
+		s.properties = s.readProperties()
+		s.handler.AddStateChangeCallback(s.update)
+	})
+
+	reply, err := s.bus.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return fmt.Errorf("error while requesting d-bus name %s: %v", serviceName, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("d-bus name %s is owned by another instance", serviceName)
+	}
+
+	return nil
+}
+
+func (s *DbusService) Close() error {
+	_, err := s.bus.ReleaseName(serviceName)
+
+	return err
+}
+
+func (s *DbusService) readProperties() map[string]dbus.Variant {
+	h := s.handler
+
+	activePlayer := ""
+	if h.player != nil {
+		activePlayer = h.player.name
+	}
+
+	players := []string{}
+	for _, player := range h.monitor.Players() {
+		players = append(players, player.name)
+	}
+
+	return map[string]dbus.Variant{
+		"ActivePlayer":       dbus.MakeVariant(activePlayer),
+		"Players":            dbus.MakeVariant(players),
+		"PlaybackStatus":     dbus.MakeVariant(h.playbackStatus),
+		"DisplayMode":        dbus.MakeVariant(displayModeNames[h.displayMode]),
+		"SegmentDisplayMode": dbus.MakeVariant(segmentDisplayModeNames[h.segmentDisplayMode]),
+	}
+}
+
+// update announces the properties which changed since the last update
+func (s *DbusService) update() {
+	properties := s.readProperties()
+
+	changed := make(map[string]dbus.Variant)
+	for name, value := range properties {
+		if !reflect.DeepEqual(value.Value(), s.properties[name].Value()) {
+			changed[name] = value
+		}
+	}
+	s.properties = properties
+
+	if len(changed) != 0 {
+		s.bus.Emit(servicePath, propertiesChanged, serviceIface, changed, []string{})
+	}
+}
+
+// getProperties returns the properties as they were last announced
+func (s *DbusService) getProperties() map[string]dbus.Variant {
+	var properties map[string]dbus.Variant
+	s.handler.call(func() {
+		properties = s.properties
+	})
+
+	return properties
+}
+
+// control runs a command of the control protocol, and returns its error as a d-bus error
+func (s *DbusService) control(request ControlRequest, errorName string) *dbus.Error {
+	response := s.handler.HandleControlRequest(request)
+	if !response.OK {
+		return dbus.NewError(errorName, []interface{}{response.Error})
+	}
+
+	return nil
+}
+
+// dbusServiceMethods are the methods of the service interface
+type dbusServiceMethods struct {
+	s *DbusService
+}
+
+func (m dbusServiceMethods) ShowMessage(text string, seconds float64, color string) *dbus.Error {
+	return m.s.control(ControlRequest{Command: "message", Text: text, Seconds: seconds, Color: color},
+		errorInvalidArgs)
+}
+
+// dbusServiceProperties implements org.freedesktop.DBus.Properties for the service interface
+type dbusServiceProperties struct {
+	s *DbusService
+}
+
+func (p dbusServiceProperties) Get(iface string, name string) (dbus.Variant, *dbus.Error) {
+	properties, err := p.GetAll(iface)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+
+	value, ok := properties[name]
+	if !ok {
+		return dbus.Variant{}, dbus.NewError(errorUnknownProperty, []interface{}{"unknown property " + name})
+	}
+
+	return value, nil
+}
+
+func (p dbusServiceProperties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	if iface != serviceIface {
+		return nil, dbus.NewError(errorUnknownInterface, []interface{}{"unknown interface " + iface})
+	}
+
+	properties := p.s.getProperties()
+	if properties == nil {
+		return nil, dbus.NewError(errorFailed, []interface{}{"the controller is shutting down"})
+	}
+
+	return properties, nil
+}
+
+func (p dbusServiceProperties) Set(iface string, name string, value dbus.Variant) *dbus.Error {
+	if iface != serviceIface {
+		return dbus.NewError(errorUnknownInterface, []interface{}{"unknown interface " + iface})
+	}
+
+	text, ok := value.Value().(string)
+
+	var request ControlRequest
+	switch name {
+	case "ActivePlayer":
+		request = ControlRequest{Command: "select", Player: text}
+	case "DisplayMode":
+		request = ControlRequest{Command: "display", Mode: text}
+	case "SegmentDisplayMode":
+		request = ControlRequest{Command: "segment", Mode: text}
+	case "Players", "PlaybackStatus":
+		return dbus.NewError(errorPropertyReadOnly, []interface{}{"property " + name + " is read-only"})
+	default:
+		return dbus.NewError(errorUnknownProperty, []interface{}{"unknown property " + name})
+	}
+
+	if !ok {
+		return dbus.NewError(errorInvalidArgs, []interface{}{"property " + name + " is a string"})
+	}
+
+	return p.s.control(request, errorInvalidArgs)
+}
+
+var dbusPropertiesIntrospectData = introspect.Interface{
+	Name: propertiesIface,
+	Methods: []introspect.Method{
+		{
+			Name: "Get",
+			Args: []introspect.Arg{
+				{Name: "interface", Type: "s", Direction: "in"},
+				{Name: "property", Type: "s", Direction: "in"},
+				{Name: "value", Type: "v", Direction: "out"},
+			},
+		},
+		{
+			Name: "GetAll",
+			Args: []introspect.Arg{
+				{Name: "interface", Type: "s", Direction: "in"},
+				{Name: "properties", Type: "a{sv}", Direction: "out"},
+			},
+		},
+		{
+			Name: "Set",
+			Args: []introspect.Arg{
+				{Name: "interface", Type: "s", Direction: "in"},
+				{Name: "property", Type: "s", Direction: "in"},
+				{Name: "value", Type: "v", Direction: "in"},
+			},
+		},
+	},
+	Signals: []introspect.Signal{{
+		Name: "PropertiesChanged",
+		Args: []introspect.Arg{
+			{Name: "interface", Type: "s"},
+			{Name: "changed_properties", Type: "a{sv}"},
+			{Name: "invalidated_properties", Type: "as"},
+		},
+	}},
+}
@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"github.com/mozillazg/go-unidecode"
 	"gitlab.com/gomidi/midi"
-	"gitlab.com/gomidi/midi/mid"
 	"gitlab.com/gomidi/midi/midimessage/channel"
+	"log"
 	"strings"
 	"time"
 )
@@ -14,21 +14,107 @@ type EventHandler struct {
 	controller *MidiController
 	monitor    *DbusMediaPlayerMonitor
 	mixer      *AudioMixer
+	bindings   *Bindings
 	player     *DbusMediaPlayer
 	track      *Track
 
+	volumeCurve *VolumeCurve
+	// faders keeps the faders of the volume actions in sync with their volumes
+	faders map[string]*Fader
+
+	playbackStatus string
+
 	displayScroll int
 	displayMode   int
 
 	segmentDisplayMode int
+
+	// segmentOverlay is shown on the segment display instead of the selected mode until segmentOverlayUntil
+	segmentOverlay      string
+	segmentOverlayUntil time.Time
+
+	seekMode  bool
+	seekSpeed float64
+	lastSeek  time.Time
+
+	// encoderRing is the value last written to the LED ring of the encoder
+	encoderRing uint8
+	// scrollFeedbackUntil is the time until which the LED ring shows the scroll position instead of the progress
+	scrollFeedbackUntil time.Time
+	// progressMeter is the value last written to the LED meter, or -1 when it has to be written
+	progressMeter int
+
+	vuMeter *VuMeter
+
+	sinkMuted   bool
+	sourceMuted bool
+	// micMuted is the mute state of the default source set with the controller, which is restored when another
+	// application unmutes it
+	micMuted bool
+
+	// pausedForCall is the player which was paused when a call started, to be resumed when it ends
+	pausedForCall *DbusMediaPlayer
+
+	// textOverlay is shown on the text display instead of the track until textOverlayUntil
+	textOverlay      []string
+	textOverlayColor uint8
+	textOverlayUntil time.Time
+
+	config *Config
+
+	// stateChangeCallbacks are called after every event, to publish the state when it changed
+	stateChangeCallbacks []func()
+	seekedCallbacks      []func(position time.Duration)
+
+	// events are the inputs of the controller and the timers, which are handled by Run
+	events chan interface{}
+	done   chan struct{}
+	// stopped is closed when Run returned
+	stopped chan struct{}
 }
 
-func NewEventHandler(controller *MidiController, monitor *DbusMediaPlayerMonitor, mixer *AudioMixer) *EventHandler {
-	return &EventHandler{
-		controller: controller,
-		monitor:    monitor,
-		mixer:      mixer,
+// midiEvent is a message received from the controller
+type midiEvent struct {
+	msg midi.Message
+}
+
+// resyncEvent is posted when the controller was (re)connected or reset
+type resyncEvent struct{}
+
+// funcEvent is a function which has to be called on the event loop, like the expiry of a timer
+type funcEvent func()
+
+func NewEventHandler(controller *MidiController, monitor *DbusMediaPlayerMonitor, mixer *AudioMixer, bindings *Bindings, volumeCurve *VolumeCurve, config *Config) *EventHandler {
+	h := &EventHandler{
+		controller:    controller,
+		monitor:       monitor,
+		mixer:         mixer,
+		bindings:      bindings,
+		volumeCurve:   volumeCurve,
+		progressMeter: -1,
+		config:        config,
+		events:        make(chan interface{}, eventQueueSize),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	h.faders = map[string]*Fader{
+		"mixer.volume": NewFader(func(value uint8) {
+			h.mixer.SetVolume(h.volumeCurve.Volume(value))
+		}, h.faderMover("mixer.volume"), h.schedule),
+		"mixer.player-volume": NewFader(func(value uint8) {
+			h.mixer.SetPlayerVolume(h.volumeCurve.Volume(value))
+		}, h.faderMover("mixer.player-volume"), h.schedule),
+		"mic.gain": NewFader(func(value uint8) {
+			h.mixer.SetSourceVolume(h.volumeCurve.Volume(value))
+		}, h.faderMover("mic.gain"), h.schedule),
 	}
+
+	if config.VuMeter.Enabled {
+		h.vuMeter = NewVuMeter(config.VuMeter, controller.SetLedMeter)
+	}
+
+	return h
 }
 
 const (
@@ -38,9 +124,37 @@ const (
 	displayAlbum       = 3
 )
 
+// displayModeNames are the names of the display modes in the control protocol
+var displayModeNames = []string{"artist-title", "artist", "title", "album"}
+
+const (
+	segmentDisplayPlayer    = 0
+	segmentDisplayTime      = 1
+	segmentDisplayElapsed   = 2
+	segmentDisplayRemaining = 3
+	segmentDisplayTotal     = 4
+	segmentDisplayModes     = 5
+)
+
+// segmentDisplayModeNames are the names of the segment display modes in the control protocol
+var segmentDisplayModeNames = []string{"player", "time", "elapsed", "remaining", "total"}
+
 const (
-	segmentDisplayPlayer = 0
-	segmentDisplayTime   = 1
+	tickInterval = 250 * time.Millisecond
+	// eventQueueSize is the number of events which can be posted before the poster blocks
+	eventQueueSize = 256
+)
+
+const (
+	// seekCenter is the value of the LED ring in seek mode, the encoder is turned relative to it
+	seekCenter = 64
+	// seekAccelerationWindow is the time within which a following encoder step accelerates the seeking
+	seekAccelerationWindow = 150 * time.Millisecond
+	segmentOverlayDuration = 2 * time.Second
+	textOverlayDuration    = 2 * time.Second
+	// scrollFeedbackDuration is the time the LED ring shows the scroll position after the encoder was turned, before
+	// it shows the progress again
+	scrollFeedbackDuration = 2 * time.Second
 )
 
 var playerColorMap = map[string]uint8{
@@ -52,18 +166,149 @@ var playerColorMap = map[string]uint8{
 func (h *EventHandler) Setup() {
 	h.HandleVolume(h.mixer.volume)
 	h.mixer.SetOnVolumeChangeCallback(h.HandleVolume)
+	if h.followsPlayerVolume() {
+		h.mixer.SetOnPlayerVolumeChangeCallback(h.HandlePlayerVolume)
+	}
+	if h.usesSource() {
+		h.mixer.TrackSource()
+	}
+	h.sinkMuted, h.sourceMuted = h.mixer.Muted()
+	h.mixer.SetOnMuteChangeCallback(h.OnMuteChanged)
+	h.mixer.SetOnSourceVolumeChangeCallback(h.HandleSourceVolume)
+	if h.config.Calls.Pause {
+		h.mixer.SetOnCallChangeCallback(h.OnCallChanged)
+		h.mixer.TrackCalls(h.config.Calls.Applications)
+	}
 	h.monitor.SetActivePlayerChangedCallback(h.OnActivePlayerChanged)
 	h.player = h.monitor.GetActivePlayer()
 	h.InitPlayer()
-	h.controller.reader.Msg.Each = h.HandleMidiMessage
-	go Ticker(250*time.Millisecond, h)
+	h.controller.SetMessageHandler(func(msg midi.Message) {
+		h.post(midiEvent{msg})
+	})
+	h.controller.SetOnResetCallback(func() {
+		h.post(resyncEvent{})
+	})
+}
+
+// Run handles the events, the signals of the players and the updates of the mixer until Close is called. All state of
+// the handler, the monitor and the mixer is owned by this loop, so it does not need locking.
+func (h *EventHandler) Run() {
+	defer close(h.stopped)
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	signals := h.monitor.Signals()
+	updates := h.mixer.Updates()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case event := <-h.events:
+			h.handleEvent(event)
+		case signal, ok := <-signals:
+			if !ok {
+				signals = nil
+				continue
+			}
+			h.monitor.HandleSignal(signal)
+		case state := <-updates:
+			h.mixer.Update(state)
+		case now := <-h.vuMeterFrames():
+			h.vuMeter.Frame(now)
+			continue
+		case <-ticker.C:
+			h.OnTick()
+		}
+
+		for _, callback := range h.stateChangeCallbacks {
+			callback()
+		}
+	}
+}
+
+// AddSeekedCallback adds a callback which is called when the active player seeked. It has to be called on the loop.
+func (h *EventHandler) AddSeekedCallback(callback func(position time.Duration)) {
+	h.seekedCallbacks = append(h.seekedCallbacks, callback)
+}
+
+// AddStateChangeCallback adds a callback which is called on the loop after every event, which may have changed the
+// state. It has to be called on the loop.
+func (h *EventHandler) AddStateChangeCallback(callback func()) {
+	h.stateChangeCallbacks = append(h.stateChangeCallbacks, callback)
+}
+
+// Close stops the event loop and waits for it to return
+func (h *EventHandler) Close() {
+	close(h.done)
+	<-h.stopped
+
+	if h.vuMeter != nil {
+		h.vuMeter.Close()
+	}
+}
+
+func (h *EventHandler) handleEvent(event interface{}) {
+	switch event := event.(type) {
+	case midiEvent:
+		h.HandleMidiMessage(event.msg)
+	case resyncEvent:
+		h.Resync()
+	case funcEvent:
+		event()
+	}
+}
+
+// post queues an event for the loop, it may be called from any goroutine except the loop itself
+func (h *EventHandler) post(event interface{}) {
+	select {
+	case h.events <- event:
+	case <-h.done:
+	}
+}
+
+// call runs f on the loop and waits for it, it returns false when the loop was stopped before f ran
+func (h *EventHandler) call(f func()) bool {
+	done := make(chan struct{})
+	h.post(funcEvent(func() {
+		f()
+		close(done)
+	}))
+
+	select {
+	case <-done:
+		return true
+	case <-h.stopped:
+		return false
+	}
+}
+
+// schedule calls f on the loop after the delay
+func (h *EventHandler) schedule(delay time.Duration, f func()) {
+	time.AfterFunc(delay, func() {
+		h.post(funcEvent(f))
+	})
+}
+
+func (h *EventHandler) vuMeterFrames() <-chan time.Time {
+	if h.vuMeter == nil {
+		return nil
+	}
+
+	return h.vuMeter.Frames()
 }
 
 func (h *EventHandler) InitPlayer() {
+	if h.followsPlayerVolume() {
+		h.mixer.FollowPlayer(h.player)
+	}
+
 	if h.player != nil {
 		playbackStatus, track := h.player.FetchProperties()
 		h.OnPropertiesChanged(playbackStatus, track)
 		h.player.SetOnPropertiesChangedHandler(h.OnPropertiesChanged)
+		h.player.SetOnSeekedHandler(h.OnSeeked)
 	} else {
 		h.OnPropertiesChanged("None", Track{})
 	}
@@ -72,6 +317,7 @@ func (h *EventHandler) InitPlayer() {
 func (h *EventHandler) OnActivePlayerChanged(player *DbusMediaPlayer) {
 	if h.player != nil {
 		h.player.SetOnPropertiesChangedHandler(nil)
+		h.player.SetOnSeekedHandler(nil)
 	}
 
 	h.player = player
@@ -79,19 +325,16 @@ func (h *EventHandler) OnActivePlayerChanged(player *DbusMediaPlayer) {
 }
 
 func (h *EventHandler) OnPropertiesChanged(playbackStatus string, track Track) {
-	switch playbackStatus {
-	case "None":
-		h.controller.writer.NoteOn(NoteStop, 0)
-		h.controller.writer.NoteOn(NotePlay, 0)
-	case "Playing":
-		h.controller.writer.NoteOn(NoteStop, 0)
-		h.controller.writer.NoteOn(NotePlay, 127)
-	case "Paused":
-		h.controller.writer.NoteOn(NoteStop, 127)
-		h.controller.writer.NoteOn(NotePlay, 0)
-	case "Stopped":
-		h.controller.writer.NoteOn(NoteStop, 127)
-		h.controller.writer.NoteOn(NotePlay, 0)
+	h.playbackStatus = playbackStatus
+	h.updatePlaybackLeds()
+
+	if h.pausedForCall == h.player && playbackStatus == "Playing" {
+		// playback was resumed during the call, so it is no longer ours to resume
+		h.pausedForCall = nil
+	}
+
+	if h.vuMeter != nil {
+		h.vuMeter.SetActive(playbackStatus == "Playing")
 	}
 
 	if track.isDifferent(h.track) {
@@ -102,7 +345,187 @@ func (h *EventHandler) OnPropertiesChanged(playbackStatus string, track Track) {
 	h.UpdateDisplay()
 }
 
+func (h *EventHandler) OnSeeked(position time.Duration) {
+	h.showSegmentOverlay(formatSegmentTime(position))
+
+	for _, callback := range h.seekedCallbacks {
+		callback(position)
+	}
+}
+
+// Resync sends the complete state to the controller, after it has been reset
+func (h *EventHandler) Resync() {
+	h.updatePlaybackLeds()
+	h.UpdateSegmentLed()
+	h.SetActionLed("player.lock", h.monitor.Locked())
+	h.SetActionLed("seek.toggle", h.seekMode)
+	h.updateMuteLeds()
+	h.HandleSourceVolume(h.mixer.SourceVolume())
+	h.HandleVolume(h.mixer.volume)
+	h.HandlePlayerVolume(h.mixer.PlayerVolume())
+	for _, fader := range h.faders {
+		fader.Refresh()
+	}
+	h.UpdateEncoderRing()
+	h.progressMeter = -1
+	h.updateProgress()
+	if h.vuMeter != nil {
+		h.vuMeter.Refresh()
+	}
+	h.UpdateDisplay()
+}
+
+func (h *EventHandler) OnMuteChanged(sinkMuted bool, sourceMuted bool) {
+	switch {
+	case sinkMuted && !h.sinkMuted:
+		h.showTextOverlay(ColorRed, "MUTED", "Output")
+	case sourceMuted && !h.sourceMuted:
+		h.showTextOverlay(ColorRed, "MUTED", "Mic")
+	case !sinkMuted && !sourceMuted && !h.textOverlayUntil.IsZero():
+		h.textOverlayUntil = time.Time{}
+		h.updateTextDisplay()
+	}
+
+	h.sinkMuted, h.sourceMuted = sinkMuted, sourceMuted
+	h.updateMuteLeds()
+
+	if h.micMuted && !sourceMuted {
+		log.Printf("microphone was unmuted by another application, muting it again")
+		h.mixer.SetSourceMute(true)
+	}
+}
+
+// OnCallChanged pauses the active player when a call starts, and resumes it when the call ends if it is still paused
+func (h *EventHandler) OnCallChanged(active bool) {
+	if active {
+		if h.player != nil && h.playbackStatus == "Playing" {
+			log.Printf("call started, pausing %s", h.player.name)
+			h.player.Pause()
+			h.pausedForCall = h.player
+		}
+		return
+	}
+
+	player := h.pausedForCall
+	h.pausedForCall = nil
+	if player != nil && player.playbackStatus == "Paused" {
+		log.Printf("call ended, resuming %s", player.name)
+		player.Play()
+	}
+}
+
+// CycleOutput switches to another output sink, and shows its description
+func (h *EventHandler) CycleOutput(offset int) {
+	sink, err := h.mixer.CycleSink(offset)
+	if err != nil {
+		log.Printf("error while switching output: %v", err)
+		return
+	}
+
+	h.showTextOverlay(ColorWhite, sink.Description)
+}
+
+// SetMicMute mutes or unmutes the default source, which then stays muted until it is unmuted with the controller
+func (h *EventHandler) SetMicMute(muted bool) {
+	h.micMuted = muted
+	h.mixer.SetSourceMute(muted)
+	h.updateMuteLeds()
+}
+
+// updateMuteLeds lights the mute buttons of which all targets are muted
+func (h *EventHandler) updateMuteLeds() {
+	h.setBindingLeds("mixer.mute", h.muteTargetsMuted)
+	h.SetActionLed("mic.mute", h.micMuted || h.sourceMuted)
+}
+
+func (h *EventHandler) muteTargetsMuted(args []string) bool {
+	sink, source := muteTargets(args)
+	sinkMuted, sourceMuted := h.mixer.Muted()
+
+	return (!sink || sinkMuted) && (!source || sourceMuted)
+}
+
+// usesSource returns true when the default source is muted or its volume controlled, of which the state then has to
+// be tracked
+func (h *EventHandler) usesSource() bool {
+	if len(h.bindings.NotesFor("mic.mute")) != 0 || len(h.bindings.ControlsFor("mic.mute")) != 0 ||
+		len(h.bindings.ControlsFor("mic.gain")) != 0 {
+		return true
+	}
+
+	for _, note := range h.bindings.NotesFor("mixer.mute") {
+		if _, source := muteTargets(h.bindings.Note(note).args); source {
+			return true
+		}
+	}
+	for _, controller := range h.bindings.ControlsFor("mixer.mute") {
+		if _, source := muteTargets(h.bindings.Control(controller).args); source {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *EventHandler) updatePlaybackLeds() {
+	switch h.playbackStatus {
+	case "None":
+		h.SetActionLed("player.stop", false)
+		h.SetActionLed("player.play-pause", false)
+	case "Playing":
+		h.SetActionLed("player.stop", false)
+		h.SetActionLed("player.play-pause", true)
+	case "Paused":
+		h.SetActionLed("player.stop", true)
+		h.SetActionLed("player.play-pause", false)
+	case "Stopped":
+		h.SetActionLed("player.stop", true)
+		h.SetActionLed("player.play-pause", false)
+	}
+}
+
+func (h *EventHandler) SetDisplayMode(mode int) {
+	h.displayMode = mode
+	h.ResetDisplayScroll()
+	h.UpdateDisplay()
+}
+
+func (h *EventHandler) SetSegmentDisplayMode(mode int) {
+	h.segmentDisplayMode = mode
+	h.UpdateSegmentLed()
+	h.UpdateDisplay()
+}
+
+// ShowMessage shows a message on the text display for the given duration, a line per row
+func (h *EventHandler) ShowMessage(text string, duration time.Duration, color uint8) {
+	h.showTextOverlayFor(duration, color, strings.Split(text, "\n")...)
+}
+
 func (h *EventHandler) UpdateDisplay() {
+	h.updateTextDisplay()
+	h.updateSegmentDisplay()
+}
+
+func (h *EventHandler) updateTextDisplay() {
+	columns, rows := h.controller.TextSize()
+	if columns == 0 {
+		return
+	}
+	width := columns * rows
+
+	if time.Now().Before(h.textOverlayUntil) {
+		text := ""
+		if len(h.textOverlay) == 1 {
+			text = h.textOverlay[0]
+		} else {
+			for _, line := range h.textOverlay {
+				text += PadRight(line, columns, 0)
+			}
+		}
+		h.controller.ShowText(PadRight(text, width, 0), h.textOverlayColor, InvertNone)
+		return
+	}
+
 	invert := InvertNone
 	color := ColorBlack
 
@@ -117,20 +540,31 @@ func (h *EventHandler) UpdateDisplay() {
 	if h.track != nil {
 		switch h.displayMode {
 		case displayArtistTitle:
-			text = PadRight(h.track.artist, 7, h.displayScroll) + PadRight(h.track.title, 7, h.displayScroll)
+			if rows > 1 {
+				text = PadRight(h.track.artist, columns, h.displayScroll) + PadRight(h.track.title, columns, h.displayScroll)
+			} else {
+				text = PadRight(h.track.artist+" - "+h.track.title, width, h.displayScroll)
+			}
 			invert = InvertTop
 		case displayArtist:
-			text = PadRight(h.track.artist, 14, h.displayScroll)
+			text = PadRight(h.track.artist, width, h.displayScroll)
 			invert = InvertBoth
 		case displayTitle:
-			text = PadRight(h.track.title, 14, h.displayScroll)
+			text = PadRight(h.track.title, width, h.displayScroll)
 		case displayAlbum:
-			text = PadRight(h.track.album, 14, h.displayScroll)
+			text = PadRight(h.track.album, width, h.displayScroll)
 		}
 	}
 
-	h.controller.writer.SysEx(h.controller.CreateLcdDisplayData(text, color, invert))
+	h.controller.ShowText(text, color, invert)
+}
+
+func (h *EventHandler) updateSegmentDisplay() {
+	if h.controller.SegmentDigits() == 0 {
+		return
+	}
 
+	text := ""
 	trackText := ""
 	if h.track != nil && h.track.trackNumber != 0 {
 		trackText = fmt.Sprintf("%d", h.track.trackNumber)
@@ -138,30 +572,134 @@ func (h *EventHandler) UpdateDisplay() {
 
 	segmentText := ""
 	segmentDisplayData := SegmentDisplayData{}
-	switch h.segmentDisplayMode {
-	case segmentDisplayPlayer:
+	switch {
+	case time.Now().Before(h.segmentOverlayUntil):
+		text = PadRight("   "+h.segmentOverlay, 9, 0) + PadLeft(trackText, 3)
+		segmentDisplayData = NewSegmentDisplayDataTime(text)
+	case h.segmentDisplayMode == segmentDisplayPlayer:
 		segmentText = "NoPlayer"
 		if h.player != nil {
 			segmentText = "  " + h.player.name
 		}
 		text = PadRight(segmentText, 9, 0) + PadLeft(trackText, 3)
 		segmentDisplayData = NewSegmentDisplayData(text)
-	case segmentDisplayTime:
+	case h.segmentDisplayMode == segmentDisplayTime:
 		segmentText = "   " + time.Now().Format("150405")
 		text = PadRight(segmentText, 9, 0) + PadLeft(trackText, 3)
 		segmentDisplayData = NewSegmentDisplayDataTime(text)
+	case h.segmentDisplayMode == segmentDisplayElapsed:
+		segmentText = "   " + formatSegmentTime(h.trackPosition())
+		text = PadRight(segmentText, 9, 0) + PadLeft(trackText, 3)
+		segmentDisplayData = NewSegmentDisplayDataTime(text)
+	case h.segmentDisplayMode == segmentDisplayRemaining:
+		segmentText = "  -" + formatSegmentTime(h.trackLength()-h.trackPosition())
+		text = PadRight(segmentText, 9, 0) + PadLeft(trackText, 3)
+		segmentDisplayData = NewSegmentDisplayDataTime(text)
+	case h.segmentDisplayMode == segmentDisplayTotal:
+		segmentText = "   " + formatSegmentTime(h.trackLength())
+		text = PadRight(segmentText, 9, 0) + PadLeft(trackText, 3)
+		segmentDisplayData = NewSegmentDisplayDataTime(text)
 	}
 
-	h.controller.writer.SysEx(h.controller.CreateSegmentDisplayData(segmentDisplayData))
+	h.controller.ShowSegments(segmentDisplayData)
 }
 
 func (h *EventHandler) OnTick() {
-	if h.segmentDisplayMode == segmentDisplayTime {
+	overlay := !h.segmentOverlayUntil.IsZero() || !h.textOverlayUntil.IsZero()
+	if overlay && time.Now().After(h.segmentOverlayUntil) {
+		h.segmentOverlayUntil = time.Time{}
+	}
+	if overlay && time.Now().After(h.textOverlayUntil) {
+		h.textOverlayUntil = time.Time{}
+	}
+
+	if h.segmentDisplayMode != segmentDisplayPlayer || overlay {
 		h.UpdateDisplay()
 	}
+
+	h.updateProgress()
+}
+
+func (h *EventHandler) trackPosition() time.Duration {
+	if h.player == nil {
+		return 0
+	}
+
+	return h.player.Position()
+}
+
+func (h *EventHandler) trackLength() time.Duration {
+	if h.track == nil {
+		return 0
+	}
+
+	return h.track.length
+}
+
+// showTextOverlay shows a message on the text display for a short while, a line per row. A single line may span all
+// rows.
+func (h *EventHandler) showTextOverlay(color uint8, lines ...string) {
+	h.showTextOverlayFor(textOverlayDuration, color, lines...)
+}
+
+func (h *EventHandler) showTextOverlayFor(duration time.Duration, color uint8, lines ...string) {
+	h.textOverlay = lines
+	h.textOverlayColor = color
+	h.textOverlayUntil = time.Now().Add(duration)
+	h.updateTextDisplay()
+}
+
+// showSegmentOverlay shows a time in the format of formatSegmentTime on the segment display for a short while
+func (h *EventHandler) showSegmentOverlay(text string) {
+	h.segmentOverlay = text
+	h.segmentOverlayUntil = time.Now().Add(segmentOverlayDuration)
+	h.updateSegmentDisplay()
 }
 
-func (h *EventHandler) HandleMidiMessage(pos *mid.Position, msg midi.Message) {
+// formatSegmentTime formats a duration as hours, minutes and seconds for NewSegmentDisplayDataTime
+func formatSegmentTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	seconds := int(d / time.Second)
+
+	return fmt.Sprintf("%02d%02d%02d", seconds/3600%100, seconds/60%60, seconds%60)
+}
+
+// Seek moves the position of the player by the number of steps the encoder was turned from seekCenter, and shows
+// the new position
+func (h *EventHandler) Seek(value uint8) {
+	steps := int(value) - seekCenter
+	h.UpdateEncoderRing()
+
+	if steps == 0 || h.player == nil {
+		return
+	}
+
+	h.player.Seek(h.seekOffset(steps))
+	h.showSegmentOverlay(formatSegmentTime(h.player.Position()))
+}
+
+// seekOffset returns the offset for the given number of encoder steps. Steps which quickly follow each other speed
+// up the seeking by the configured acceleration, up to the maximum step.
+func (h *EventHandler) seekOffset(steps int) time.Duration {
+	now := time.Now()
+	if now.Sub(h.lastSeek) < seekAccelerationWindow {
+		h.seekSpeed += h.config.Seek.Acceleration
+	} else {
+		h.seekSpeed = 1
+	}
+	h.lastSeek = now
+
+	step := h.config.Seek.Step * h.seekSpeed
+	if step > h.config.Seek.MaxStep {
+		step = h.config.Seek.MaxStep
+	}
+
+	return time.Duration(float64(steps) * step * float64(time.Second))
+}
+
+func (h *EventHandler) HandleMidiMessage(msg midi.Message) {
 	if note, ok := msg.(channel.NoteOn); ok {
 		h.handleNoteOn(&note)
 	}
@@ -178,72 +716,138 @@ func (h *EventHandler) handleNoteOn(note *channel.NoteOn) {
 		return
 	}
 
-	switch note.Key() {
-	case NotePrevious:
-		if h.player != nil {
-			h.player.Previous()
-			h.player.Play()
-		}
-	case NoteNext:
-		if h.player != nil {
-			h.player.Next()
-			h.player.Play()
-		}
-	case NoteStop:
-		if h.player != nil {
-			h.player.Stop()
-		}
-	case NotePlay:
-		if h.player != nil {
-			h.player.PlayPause()
-		}
-	case NoteEncoder:
-		h.displayMode = (h.displayMode + 1) % 4
-		h.ResetDisplayScroll()
-		h.UpdateDisplay()
-	case NoteBankLeft:
-		h.monitor.SelectPlayer(-1)
-	case NoteBankRight:
-		h.monitor.SelectPlayer(+1)
-	case NoteFader:
-		h.mixer.SetOnVolumeChangeCallback(nil)
-	case NoteTime:
-		if h.segmentDisplayMode == segmentDisplayPlayer {
-			h.segmentDisplayMode = segmentDisplayTime
-			h.controller.writer.NoteOn(NoteTime, 127)
-		} else {
-			h.segmentDisplayMode = segmentDisplayPlayer
-			h.controller.writer.NoteOn(NoteTime, 0)
-		}
-
-		h.UpdateDisplay()
+	if binding := h.bindings.Note(note.Key()); binding != nil {
+		binding.handle(h, binding.args, note.Velocity())
 	}
 }
 
 func (h *EventHandler) handleNoteOff(note *channel.NoteOff) {
-	switch note.Key() {
-	case NoteFader:
-		h.mixer.SetOnVolumeChangeCallback(h.HandleVolume)
+	if binding := h.bindings.Note(note.Key()); binding != nil && binding.kind == actionTouch {
+		binding.handle(h, binding.args, 0)
 	}
 }
 
 func (h *EventHandler) handleControlChange(cc *channel.ControlChange) {
-	switch cc.Controller() {
-	case CcFader:
-		h.mixer.SetVolume(float32(cc.Value()) / 127)
-	case CcLedRing:
-		h.displayScroll = int(cc.Value())
-		h.UpdateDisplay()
+	binding := h.bindings.Control(cc.Controller())
+	if binding == nil {
+		return
+	}
+
+	// buttons which send control changes are pressed with a value above 0 and released with 0
+	if binding.kind == actionButton && cc.Value() == 0 {
+		return
+	}
+
+	binding.handle(h, binding.args, cc.Value())
+}
+
+// SetActionLed switches the LEDs of all buttons bound to the given action
+func (h *EventHandler) SetActionLed(action string, on bool) {
+	for _, note := range h.bindings.NotesFor(action) {
+		h.controller.SetNoteLed(note, on)
+	}
+	for _, controller := range h.bindings.ControlsFor(action) {
+		h.controller.SetControlLed(controller, on)
+	}
+}
+
+// setBindingLeds switches the LEDs of all buttons bound to the given action, depending on the arguments of each
+// binding
+func (h *EventHandler) setBindingLeds(action string, on func(args []string) bool) {
+	for _, note := range h.bindings.NotesFor(action) {
+		h.controller.SetNoteLed(note, on(h.bindings.Note(note).args))
+	}
+	for _, controller := range h.bindings.ControlsFor(action) {
+		h.controller.SetControlLed(controller, on(h.bindings.Control(controller).args))
 	}
 }
 
+func (h *EventHandler) UpdateSegmentLed() {
+	h.SetActionLed("segment.toggle", h.segmentDisplayMode != segmentDisplayPlayer)
+}
+
 func (h *EventHandler) ResetDisplayScroll() {
 	h.displayScroll = 0
-	h.controller.writer.ControlChange(CcLedRing, 0)
+	h.UpdateEncoderRing()
+}
+
+// UpdateEncoderRing shows the scroll position or the progress of the track on the LED ring of the encoder, or
+// centers it in seek mode
+func (h *EventHandler) UpdateEncoderRing() {
+	value := h.encoderRingValue()
+	h.encoderRing = value
+
+	for _, controller := range h.bindings.ControlsFor("display.scroll") {
+		h.controller.SetLedRing(controller, value)
+	}
+}
+
+func (h *EventHandler) encoderRingValue() uint8 {
+	switch {
+	case h.seekMode:
+		return seekCenter
+	case h.config.Progress.Ring && time.Now().After(h.scrollFeedbackUntil):
+		return h.progressValue()
+	}
+
+	return uint8(h.displayScroll)
+}
+
+// updateProgress writes the progress of the track to the LED ring and meter, when it changed
+func (h *EventHandler) updateProgress() {
+	if h.encoderRingValue() != h.encoderRing {
+		h.UpdateEncoderRing()
+	}
+
+	if h.config.Progress.Meter {
+		value := h.progressValue()
+		if int(value) != h.progressMeter {
+			h.progressMeter = int(value)
+			h.controller.SetLedMeter(value)
+		}
+	}
+}
+
+// progressValue returns the progress of the track from 0 to 127
+func (h *EventHandler) progressValue() uint8 {
+	length := h.trackLength()
+	if length <= 0 {
+		return 0
+	}
+
+	return clampMidiValue(int(h.trackPosition() * 127 / length))
 }
 
 func (h *EventHandler) HandleVolume(volume float32) {
-	h.controller.writer.ControlChange(CcFader, uint8(volume*127))
+	h.faders["mixer.volume"].Volume(h.volumeCurve.Value(volume))
+}
+
+func (h *EventHandler) HandleSourceVolume(volume float32) {
+	h.faders["mic.gain"].Volume(h.volumeCurve.Value(volume))
+}
+
+func (h *EventHandler) HandlePlayerVolume(volume float32) {
+	h.faders["mixer.player-volume"].Volume(h.volumeCurve.Value(volume))
+}
+
+// faderMover returns a function which moves the faders bound to the given action, or sets the LED rings of the
+// encoders bound to it with args = ["encoder"]
+func (h *EventHandler) faderMover(action string) func(value uint8) {
+	return func(value uint8) {
+		for _, controller := range h.bindings.ControlsFor(action) {
+			if args := h.bindings.Control(controller).args; len(args) != 0 && args[0] == "encoder" {
+				h.controller.SetLedRing(controller, value)
+			} else {
+				h.controller.SetFader(controller, value)
+			}
+		}
+	}
+}
+
+// followsPlayerVolume returns true when a fader is bound to the volume of the active player, for which its streams
+// have to be looked up
+func (h *EventHandler) followsPlayerVolume() bool {
+	return len(h.bindings.ControlsFor("mixer.player-volume")) != 0
 }
 
 func PadRight(text string, l int, offset int) string {
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"github.com/godbus/dbus"
+	"gitlab.com/gomidi/midi/mid"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testMidiDriver is a mid.Driver with a single input, of which the test sends the messages, and an output which
+// counts the messages sent to it
+type testMidiDriver struct {
+	in  *virtualIn
+	out *testMidiOut
+}
+
+func (d *testMidiDriver) Ins() ([]mid.In, error) {
+	return []mid.In{d.in}, nil
+}
+
+func (d *testMidiDriver) Outs() ([]mid.Out, error) {
+	return []mid.Out{d.out}, nil
+}
+
+func (d *testMidiDriver) String() string {
+	return "test"
+}
+
+func (d *testMidiDriver) Close() error {
+	d.in.Close()
+	d.out.Close()
+
+	return nil
+}
+
+type testMidiOut struct {
+	virtualPort
+	sent int64
+}
+
+func (p *testMidiOut) Send(data []byte) error {
+	if !p.IsOpen() {
+		return mid.ErrClosed
+	}
+
+	atomic.AddInt64(&p.sent, 1)
+
+	return nil
+}
+
+// fakePlayerObject is the MPRIS object of a player, which answers the property requests and records the calls
+type fakePlayerObject struct {
+	mutex sync.Mutex
+	calls map[string]int
+}
+
+func (o *fakePlayerObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	o.mutex.Lock()
+	o.calls[method]++
+	o.mutex.Unlock()
+
+	if method != propertiesGet {
+		return &dbus.Call{}
+	}
+
+	var value interface{}
+	switch args[1] {
+	case "PlaybackStatus":
+		value = "Paused"
+	case "Metadata":
+		value = map[string]dbus.Variant{
+			"xesam:artist": dbus.MakeVariant([]string{"Artist"}),
+			"xesam:title":  dbus.MakeVariant("Title"),
+			"mpris:length": dbus.MakeVariant(int64(180 * time.Second / time.Microsecond)),
+		}
+	case "Rate":
+		value = 1.0
+	case "Position":
+		value = int64(0)
+	}
+
+	return &dbus.Call{Body: []interface{}{value}}
+}
+
+func (o *fakePlayerObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return o.Call(method, flags, args...)
+}
+
+func (o *fakePlayerObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return o.Call(method, flags, args...)
+}
+
+func (o *fakePlayerObject) GoWithContext(ctx context.Context, method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return o.Call(method, flags, args...)
+}
+
+func (o *fakePlayerObject) AddMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+func (o *fakePlayerObject) RemoveMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+func (o *fakePlayerObject) GetProperty(p string) (dbus.Variant, error) {
+	return dbus.Variant{}, nil
+}
+
+func (o *fakePlayerObject) StoreProperty(p string, value interface{}) error {
+	return nil
+}
+
+func (o *fakePlayerObject) SetProperty(p string, v interface{}) error {
+	return nil
+}
+
+func (o *fakePlayerObject) Destination() string {
+	return ""
+}
+
+func (o *fakePlayerObject) Path() dbus.ObjectPath {
+	return mprisPath
+}
+
+func (o *fakePlayerObject) callCount(method string) int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.calls[method]
+}
+
+func newTestPlayer(name string, owner string, registration int) *DbusMediaPlayer {
+	return &DbusMediaPlayer{
+		busName:      mediaPlayerPrefix + name,
+		owner:        owner,
+		name:         name,
+		nameLower:    name,
+		registration: registration,
+		mprisObj:     &fakePlayerObject{calls: map[string]int{}},
+		rate:         1,
+	}
+}
+
+func uint8Pointer(value uint8) *uint8 {
+	return &value
+}
+
+// TestEventHandlerConcurrentSources feeds the event loop from all of its sources at once: MIDI messages, D-Bus
+// signals, mixer updates, timers and control requests. It is meant to be run with -race.
+func TestEventHandlerConcurrentSources(t *testing.T) {
+	const (
+		notePlayPause  = 23
+		noteLock       = 24
+		noteSelectNext = 26
+		noteTouch      = 110
+		controlFader   = 70
+		controlScroll  = 80
+		iterations     = 200
+	)
+
+	config, err := LoadConfig("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Bindings = []BindingConfig{
+		{Note: uint8Pointer(0), Action: "display.cycle"},
+		{Note: uint8Pointer(1), Action: "segment.toggle"},
+		{Note: uint8Pointer(notePlayPause), Action: "player.play-pause"},
+		{Note: uint8Pointer(noteLock), Action: "player.lock"},
+		{Note: uint8Pointer(noteSelectNext), Action: "player.select-next"},
+		{Note: uint8Pointer(noteTouch), Action: "mixer.touch", Args: []string{"mixer.player-volume"}},
+		{Control: uint8Pointer(controlFader), Action: "mixer.player-volume"},
+		{Control: uint8Pointer(controlScroll), Action: "display.scroll"},
+	}
+	bindings, err := NewBindings(config.Bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := GetControllerProfile("x-touch-one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := profile.(ModeSelector).SetMode(xTouchOneModeStandard); err != nil {
+		t.Fatal(err)
+	}
+
+	driver := &testMidiDriver{
+		in:  &virtualIn{virtualPort: virtualPort{name: "test"}},
+		out: &testMidiOut{virtualPort: virtualPort{name: "test"}},
+	}
+	selector, err := ParsePortSelector("name:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller := NewMidiController(driver, profile, selector, selector)
+	controller.checkConnection()
+	if !controller.Connected() {
+		t.Fatal("controller did not connect")
+	}
+	defer controller.Close()
+
+	players := []*DbusMediaPlayer{newTestPlayer("one", ":1.1", 1), newTestPlayer("two", ":1.2", 2)}
+	activePlayer := players[0].owner
+	monitor := NewDbusMediaPlayerMonitor(nil)
+	monitor.playerList = map[string]*DbusMediaPlayer{players[0].owner: players[0], players[1].owner: players[1]}
+	monitor.activePlayer = &activePlayer
+	monitor.signal = make(chan *dbus.Signal)
+
+	mixer := NewAudioMixer(config.Mixer)
+
+	volumeCurve, err := NewVolumeCurve(config.Mixer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewEventHandler(controller, monitor, mixer, bindings, volumeCurve, config)
+	h.Setup()
+	go h.Run()
+	defer h.Close()
+
+	var stateChanges int
+	h.call(func() {
+		h.AddStateChangeCallback(func() {
+			stateChanges++
+		})
+	})
+
+	var wg sync.WaitGroup
+	run := func(source func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				source(i)
+			}
+		}()
+	}
+
+	run(func(i int) {
+		driver.in.send([]byte{0x90, noteTouch, 127})
+		driver.in.send([]byte{0xB0, controlFader, uint8(i % 128)})
+		driver.in.send([]byte{0x80, noteTouch, 0})
+		driver.in.send([]byte{0xB0, controlScroll, uint8(1 + i%2*64)})
+		driver.in.send([]byte{0x90, notePlayPause, 127})
+		driver.in.send([]byte{0x90, uint8(i % 2), 127})
+		if i%10 == 0 {
+			driver.in.send([]byte{0x90, noteLock, 127})
+			driver.in.send([]byte{0x90, noteSelectNext, 127})
+		}
+	})
+	run(func(i int) {
+		status := "Paused"
+		if i%2 == 0 {
+			status = "Playing"
+		}
+		player := players[i%len(players)]
+		monitor.signal <- &dbus.Signal{
+			Sender: player.owner,
+			Name:   propertiesChanged,
+			Body: []interface{}{mprisPlayerName, map[string]dbus.Variant{
+				"PlaybackStatus": dbus.MakeVariant(status),
+			}},
+		}
+		monitor.signal <- &dbus.Signal{
+			Sender: player.owner,
+			Name:   seeked,
+			Body:   []interface{}{int64(i) * int64(time.Second/time.Microsecond)},
+		}
+	})
+	run(func(i int) {
+		mixer.updates <- mixerState{
+			volume:      float32(i%100) / 100,
+			volumeOK:    true,
+			sinkMuted:   i%3 == 0,
+			sinkMutedOK: true,
+			player:      players[i%len(players)],
+		}
+	})
+	run(func(i int) {
+		h.schedule(time.Duration(i%5)*time.Millisecond, func() {
+			h.SetDisplayMode(i % len(displayModeNames))
+		})
+		switch i % 3 {
+		case 0:
+			if response := h.HandleControlRequest(ControlRequest{Command: "state"}); !response.OK {
+				t.Errorf("state request failed: %s", response.Error)
+			}
+		case 1:
+			h.HandleControlRequest(ControlRequest{Command: "action", Action: "display.cycle"})
+		case 2:
+			h.HandleControlRequest(ControlRequest{Command: "message", Text: "Hello"})
+		}
+	})
+
+	wg.Wait()
+	// the scheduled functions, fader writes and settles have run after this
+	time.Sleep(faderSettleTime + faderMotorInterval + 10*time.Millisecond)
+
+	var playPauses int
+	var changes int
+	if !h.call(func() {
+		for _, player := range players {
+			playPauses += player.mprisObj.(*fakePlayerObject).callCount(playPause)
+		}
+		changes = stateChanges
+	}) {
+		t.Fatal("event loop stopped")
+	}
+
+	if playPauses != iterations {
+		t.Errorf("expected %d play-pause calls, got %d", iterations, playPauses)
+	}
+	if changes == 0 {
+		t.Error("state change callbacks were not called")
+	}
+	if atomic.LoadInt64(&driver.out.sent) == 0 {
+		t.Error("nothing was written to the controller")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import "time"
+
+const (
+	// faderWriteInterval is the time over which the values of a moving fader are coalesced into one volume change
+	faderWriteInterval = 30 * time.Millisecond
+	// faderMotorInterval is the minimum time between two moves of the motor
+	faderMotorInterval = 50 * time.Millisecond
+	// faderSettleTime is the time after a release after which the fader is moved to the final volume
+	faderSettleTime = 250 * time.Millisecond
+	// faderHysteresis is the difference between the volume and the motor position which is ignored, so rounding of
+	// the volume and small external changes do not make the motor jitter
+	faderHysteresis = 1
+)
+
+// Fader keeps a motorized fader and the volume it controls in sync, without the motor fighting the hand. While the
+// fader is touched, volume changes do not move the motor; the final volume is shown again after it is released.
+// Fader values are coalesced into volume writes and motor moves are rate limited.
+//
+// A fader is owned by the event loop: its methods and the functions passed to schedule have to be called from it.
+type Fader struct {
+	write    func(value uint8)
+	move     func(value uint8)
+	schedule func(delay time.Duration, f func())
+	// now returns the current time, for the rate limiting of the motor
+	now func() time.Time
+
+	touched bool
+	// touchGeneration is incremented on every touch and release, so a scheduled settle can see it is outdated
+	touchGeneration int
+	// input is the last value received from the fader, pending until the next write
+	input        uint8
+	inputPending bool
+	// volume is the last value of the volume, motor the last value the motor was moved to (or -1)
+	volume      uint8
+	motor       int
+	motorTime   time.Time
+	movePending bool
+}
+
+// NewFader creates a fader which calls write to set the volume and move to move the motor. Delayed work is passed to
+// schedule, which has to call it on the event loop after the delay.
+func NewFader(write func(value uint8), move func(value uint8), schedule func(delay time.Duration, f func())) *Fader {
+	return &Fader{
+		write:    write,
+		move:     move,
+		schedule: schedule,
+		now:      time.Now,
+		motor:    -1,
+	}
+}
+
+// Input handles a value from the fader
+func (f *Fader) Input(value uint8) {
+	f.input = value
+	if !f.inputPending {
+		f.inputPending = true
+		f.schedule(faderWriteInterval, f.flushInput)
+	}
+}
+
+func (f *Fader) flushInput() {
+	if !f.inputPending {
+		return
+	}
+	f.inputPending = false
+	f.volume = f.input
+	f.motor = int(f.input)
+
+	f.write(f.input)
+}
+
+// Touch handles touching and releasing the fader
+func (f *Fader) Touch(touched bool) {
+	f.touched = touched
+	f.touchGeneration++
+	if touched {
+		return
+	}
+
+	generation := f.touchGeneration
+	f.schedule(faderSettleTime, func() {
+		if generation != f.touchGeneration {
+			return
+		}
+
+		f.flushInput()
+		f.Refresh()
+	})
+}
+
+// Volume handles a change of the volume, to which the motor is moved when the fader is not touched
+func (f *Fader) Volume(value uint8) {
+	f.volume = value
+	if f.touched || f.inputPending {
+		return
+	}
+
+	if f.motor >= 0 && absDiff(value, uint8(f.motor)) <= faderHysteresis {
+		return
+	}
+
+	f.scheduleMove()
+}
+
+// Refresh moves the motor to the volume, after the controller was reset or the fader released
+func (f *Fader) Refresh() {
+	if f.touched {
+		return
+	}
+
+	f.motor = -1
+	f.scheduleMove()
+}
+
+// scheduleMove moves the motor to the volume, or later when it was moved too recently. A move which is still pending
+// is not scheduled again, as it moves to the volume at that time.
+func (f *Fader) scheduleMove() {
+	if f.movePending {
+		return
+	}
+
+	wait := faderMotorInterval - f.now().Sub(f.motorTime)
+	if wait <= 0 {
+		f.moveMotor()
+		return
+	}
+
+	f.movePending = true
+	generation := f.touchGeneration
+	f.schedule(wait, func() {
+		f.movePending = false
+		if !f.touched && generation == f.touchGeneration {
+			f.moveMotor()
+		}
+	})
+}
+
+func (f *Fader) moveMotor() {
+	f.motor = int(f.volume)
+	f.motorTime = f.now()
+	f.move(f.volume)
+}
+
+func absDiff(a uint8, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+
+	return b - a
+}
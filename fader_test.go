@@ -0,0 +1,203 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeClock runs scheduled functions when the time is advanced past their delay, in the order of their due time
+type fakeClock struct {
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	f  func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) schedule(delay time.Duration, f func()) {
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(delay), f: f})
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].at.Before(c.timers[j].at)
+		})
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			break
+		}
+
+		timer := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = timer.at
+		timer.f()
+	}
+	c.now = end
+}
+
+// faderStep is one step of a fader test: an input of the fader, a touch or release, a volume change or the passing
+// of time
+type faderStep struct {
+	input   int
+	touch   int
+	volume  int
+	advance time.Duration
+}
+
+func faderInput(value int) faderStep  { return faderStep{input: value, touch: -1, volume: -1} }
+func faderVolume(value int) faderStep { return faderStep{input: -1, touch: -1, volume: value} }
+func faderTouch() faderStep           { return faderStep{input: -1, touch: 1, volume: -1} }
+func faderRelease() faderStep         { return faderStep{input: -1, touch: 0, volume: -1} }
+func faderWait(d time.Duration) faderStep {
+	return faderStep{input: -1, touch: -1, volume: -1, advance: d}
+}
+
+func TestFader(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []faderStep
+		writes []uint8
+		moves  []uint8
+	}{
+		{
+			name: "inputs within the write interval are coalesced",
+			steps: []faderStep{
+				faderInput(10), faderInput(20), faderWait(10 * time.Millisecond), faderInput(30),
+				faderWait(faderWriteInterval),
+			},
+			writes: []uint8{30},
+		},
+		{
+			name: "inputs in separate write intervals are written separately",
+			steps: []faderStep{
+				faderInput(10), faderWait(faderWriteInterval), faderInput(20), faderInput(30),
+				faderWait(faderWriteInterval),
+			},
+			writes: []uint8{10, 30},
+		},
+		{
+			name: "an echo of the volume does not move the motor while an input is pending",
+			steps: []faderStep{
+				faderInput(80), faderVolume(20), faderWait(faderWriteInterval), faderVolume(80),
+				faderWait(time.Second),
+			},
+			writes: []uint8{80},
+		},
+		{
+			name:  "the motor is moved to a volume change",
+			steps: []faderStep{faderVolume(40)},
+			moves: []uint8{40},
+		},
+		{
+			name: "motor moves are rate limited to the last volume",
+			steps: []faderStep{
+				faderVolume(10), faderWait(10 * time.Millisecond), faderVolume(20), faderWait(10 * time.Millisecond),
+				faderVolume(30), faderWait(faderMotorInterval - 21*time.Millisecond),
+			},
+			moves: []uint8{10},
+		},
+		{
+			name: "a rate limited move follows after the motor interval",
+			steps: []faderStep{
+				faderVolume(10), faderWait(10 * time.Millisecond), faderVolume(20), faderWait(10 * time.Millisecond),
+				faderVolume(30), faderWait(faderMotorInterval),
+			},
+			moves: []uint8{10, 30},
+		},
+		{
+			name: "changes within the hysteresis do not move the motor",
+			steps: []faderStep{
+				faderVolume(50), faderWait(time.Second), faderVolume(51), faderWait(time.Second), faderVolume(53),
+			},
+			moves: []uint8{50, 53},
+		},
+		{
+			name:  "a volume change does not move a touched fader",
+			steps: []faderStep{faderTouch(), faderVolume(50), faderWait(time.Second)},
+		},
+		{
+			name: "a pending move is dropped when the fader is touched",
+			steps: []faderStep{
+				faderVolume(10), faderWait(10 * time.Millisecond), faderVolume(30), faderTouch(),
+				faderWait(time.Second),
+			},
+			moves: []uint8{10},
+		},
+		{
+			name: "the fader is not moved before the settle time",
+			steps: []faderStep{
+				faderTouch(), faderInput(40), faderWait(faderWriteInterval), faderVolume(60), faderRelease(),
+				faderWait(faderSettleTime - time.Millisecond),
+			},
+			writes: []uint8{40},
+		},
+		{
+			name: "the fader settles to the final volume after a release",
+			steps: []faderStep{
+				faderTouch(), faderInput(40), faderWait(faderWriteInterval), faderVolume(60), faderRelease(),
+				faderWait(faderSettleTime),
+			},
+			writes: []uint8{40},
+			moves:  []uint8{60},
+		},
+		{
+			name: "a touch before the settle time cancels the settle",
+			steps: []faderStep{
+				faderTouch(), faderVolume(70), faderRelease(), faderWait(faderSettleTime / 2), faderTouch(),
+				faderWait(time.Second),
+			},
+		},
+		{
+			name:   "a release right after an input writes the input and settles to it",
+			steps:  []faderStep{faderTouch(), faderInput(90), faderRelease(), faderWait(faderSettleTime)},
+			writes: []uint8{90},
+			moves:  []uint8{90},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeClock()
+			var writes, moves []uint8
+			fader := NewFader(func(value uint8) {
+				writes = append(writes, value)
+			}, func(value uint8) {
+				moves = append(moves, value)
+			}, clock.schedule)
+			fader.now = clock.Now
+
+			for _, step := range test.steps {
+				switch {
+				case step.input >= 0:
+					fader.Input(uint8(step.input))
+				case step.touch >= 0:
+					fader.Touch(step.touch == 1)
+				case step.volume >= 0:
+					fader.Volume(uint8(step.volume))
+				default:
+					clock.advance(step.advance)
+				}
+			}
+
+			if !reflect.DeepEqual(writes, test.writes) {
+				t.Errorf("expected writes %v, got %v", test.writes, writes)
+			}
+			if !reflect.DeepEqual(moves, test.moves) {
+				t.Errorf("expected moves %v, got %v", test.moves, moves)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// HttpServer serves the state of the controller and runs commands over HTTP, and pushes the state to WebSocket
+// clients when it changes:
+//
+//	GET  /state           the state as JSON
+//	POST /command         a request of the control protocol
+//	POST /actions/<name>  an action, with an optional body like {"args": ["source"], "value": 100}
+//	GET  /ws              a WebSocket which receives the state on every change
+type HttpServer struct {
+	handler  ControlHandler
+	mux      *http.ServeMux
+	server   *http.Server
+	upgrader websocket.Upgrader
+
+	mutex   sync.Mutex
+	clients map[chan *ControlState]struct{}
+	// state is the state last pushed to the clients, which is only used by update
+	state *ControlState
+}
+
+func NewHttpServer(handler ControlHandler) *HttpServer {
+	s := &HttpServer{
+		handler: handler,
+		mux:     http.NewServeMux(),
+		clients: make(map[chan *ControlState]struct{}),
+	}
+
+	s.mux.HandleFunc("/state", s.handleState)
+	s.mux.HandleFunc("/command", s.handleCommand)
+	s.mux.HandleFunc("/actions/", s.handleAction)
+	s.mux.HandleFunc("/ws", s.handleWebSocket)
+
+	return s
+}
+
+// Init starts following the state of the handler, the event loop has to be running. Start calls it, a server which
+// is served otherwise (like with httptest) has to call it itself.
+func (s *HttpServer) Init() {
+	s.handler.AddControlStateCallback(s.update)
+}
+
+// Start initializes the server and listens on the given address
+func (s *HttpServer) Start(address string) error {
+	s.Init()
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("error while starting http server: %v", err)
+	}
+
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(listener)
+
+	return nil
+}
+
+// Close stops the server and disconnects the WebSocket clients
+func (s *HttpServer) Close() error {
+	s.mutex.Lock()
+	for states := range s.clients {
+		close(states)
+	}
+	s.clients = nil
+	s.mutex.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+
+	return s.server.Close()
+}
+
+func (s *HttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowedHttpRequest(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// allowedHttpRequest protects the server against web pages: the host has to be an address or localhost, so a page
+// cannot reach it through a name it resolves to this machine, and the request may not come from a page of another
+// origin
+func allowedHttpRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	host = strings.Trim(host, "[]")
+	if host != "localhost" && net.ParseIP(host) == nil {
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+
+	originURL, err := url.Parse(origin)
+
+	return err == nil && originURL.Host == r.Host
+}
+
+// update pushes the state to the clients when it changed, except for the position which changes continuously. The
+// first state is only remembered.
+func (s *HttpServer) update(state *ControlState) {
+	if s.state == nil {
+		s.state = state
+		return
+	}
+
+	previous, current := *s.state, *state
+	previous.Position, current.Position = 0, 0
+	if reflect.DeepEqual(previous, current) {
+		return
+	}
+	s.state = state
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// a client which did not receive the previous state yet only receives the latest
+	for states := range s.clients {
+		select {
+		case <-states:
+		default:
+		}
+		states <- state
+	}
+}
+
+func (s *HttpServer) subscribe() chan *ControlState {
+	states := make(chan *ControlState, 1)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.clients == nil {
+		close(states)
+	} else {
+		s.clients[states] = struct{}{}
+	}
+
+	return states
+}
+
+func (s *HttpServer) unsubscribe(states chan *ControlState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.clients, states)
+}
+
+func (s *HttpServer) handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := s.handler.HandleControlRequest(ControlRequest{Command: "state"})
+	if !response.OK {
+		s.writeResponse(w, response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response.State)
+}
+
+func (s *HttpServer) handleCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request ControlRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		s.writeResponse(w, ControlResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	s.runCommand(w, request)
+}
+
+func (s *HttpServer) handleAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the body is optional, the length of a chunked body is not known until it is read
+	var request ControlRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil && err != io.EOF {
+		s.writeResponse(w, ControlResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	request.Command = "action"
+	request.Action = strings.TrimPrefix(r.URL.Path, "/actions/")
+
+	s.runCommand(w, request)
+}
+
+func (s *HttpServer) runCommand(w http.ResponseWriter, request ControlRequest) {
+	// unlike the control socket, the port can be reached by other users of this machine
+	if request.Command == "action" && request.Action == "exec" {
+		s.writeResponse(w, ControlResponse{Error: "action exec is not available over http"})
+		return
+	}
+
+	s.writeResponse(w, s.handler.HandleControlRequest(request))
+}
+
+func (s *HttpServer) writeResponse(w http.ResponseWriter, response ControlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if !response.OK {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *HttpServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has responded with the error
+		return
+	}
+	defer conn.Close()
+
+	states := s.subscribe()
+	defer s.unsubscribe(states)
+
+	// messages of the client are not used, but have to be read to notice that it disconnected
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	state := s.handler.HandleControlRequest(ControlRequest{Command: "state"}).State
+	for state != nil {
+		err := conn.WriteJSON(state)
+		if err != nil {
+			return
+		}
+
+		select {
+		case state = <-states:
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeControlHandler records the requests and answers them with its state, which the test changes with setState
+type fakeControlHandler struct {
+	mutex     sync.Mutex
+	requests  []ControlRequest
+	state     ControlState
+	callbacks []func(state *ControlState)
+}
+
+func (h *fakeControlHandler) HandleControlRequest(request ControlRequest) ControlResponse {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.requests = append(h.requests, request)
+
+	switch request.Command {
+	case "state":
+		state := h.state
+		return ControlResponse{OK: true, State: &state}
+	case "action":
+		if _, found := actions[request.Action]; !found {
+			return ControlResponse{Error: "unknown action " + request.Action}
+		}
+	}
+
+	return ControlResponse{OK: true}
+}
+
+func (h *fakeControlHandler) AddControlStateCallback(callback func(state *ControlState)) {
+	h.mutex.Lock()
+	state := h.state
+	h.callbacks = append(h.callbacks, callback)
+	h.mutex.Unlock()
+
+	callback(&state)
+}
+
+// setState changes the state and calls the callbacks, like the event loop after an event
+func (h *fakeControlHandler) setState(change func(state *ControlState)) {
+	h.mutex.Lock()
+	change(&h.state)
+	state := h.state
+	callbacks := h.callbacks
+	h.mutex.Unlock()
+
+	for _, callback := range callbacks {
+		callback(&state)
+	}
+}
+
+// actionRequests returns the recorded requests of the action command
+func (h *fakeControlHandler) actionRequests() []ControlRequest {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var requests []ControlRequest
+	for _, request := range h.requests {
+		if request.Command == "action" {
+			requests = append(requests, request)
+		}
+	}
+
+	return requests
+}
+
+func newTestHttpServer() (*HttpServer, *fakeControlHandler) {
+	handler := &fakeControlHandler{
+		state: ControlState{Player: "spotify", Players: []string{"spotify"}, PlaybackStatus: "Playing", Title: "Song"},
+	}
+	s := NewHttpServer(handler)
+	s.Init()
+
+	return s, handler
+}
+
+func TestHttpServerState(t *testing.T) {
+	s, handler := newTestHttpServer()
+	server := httptest.NewServer(s)
+	defer server.Close()
+	defer s.Close()
+
+	response, err := http.Get(server.URL + "/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, response.StatusCode)
+	}
+
+	var state ControlState
+	if err := json.NewDecoder(response.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state, handler.state) {
+		t.Errorf("expected state %+v, got %+v", handler.state, state)
+	}
+
+	response, err = http.Post(server.URL+"/state", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for POST, got %d", http.StatusMethodNotAllowed, response.StatusCode)
+	}
+}
+
+func TestHttpServerActions(t *testing.T) {
+	value := uint8(100)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		// chunked sends the body without a length
+		chunked bool
+		status  int
+		request *ControlRequest
+	}{
+		{
+			name:    "action without body",
+			path:    "/actions/player.next",
+			status:  http.StatusOK,
+			request: &ControlRequest{Command: "action", Action: "player.next"},
+		},
+		{
+			name:    "action with an empty chunked body",
+			path:    "/actions/player.next",
+			chunked: true,
+			status:  http.StatusOK,
+			request: &ControlRequest{Command: "action", Action: "player.next"},
+		},
+		{
+			name:    "action with a chunked body",
+			path:    "/actions/mixer.mute",
+			body:    `{"args": ["source"]}`,
+			chunked: true,
+			status:  http.StatusOK,
+			request: &ControlRequest{Command: "action", Action: "mixer.mute", Args: []string{"source"}},
+		},
+		{
+			name:    "action with args and value",
+			path:    "/actions/mixer.mute",
+			body:    `{"args": ["source"], "value": 100}`,
+			status:  http.StatusOK,
+			request: &ControlRequest{Command: "action", Action: "mixer.mute", Args: []string{"source"}, Value: &value},
+		},
+		{
+			name:    "the command and action of the body are ignored",
+			path:    "/actions/player.stop",
+			body:    `{"command": "select", "action": "exec"}`,
+			status:  http.StatusOK,
+			request: &ControlRequest{Command: "action", Action: "player.stop"},
+		},
+		{
+			name:    "an error of the handler",
+			path:    "/actions/unknown",
+			status:  http.StatusBadRequest,
+			request: &ControlRequest{Command: "action", Action: "unknown"},
+		},
+		{
+			name:   "an invalid body",
+			path:   "/actions/player.next",
+			body:   `{"args":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "exec is rejected",
+			path:   "/actions/exec",
+			body:   `{"args": ["touch", "/tmp/owned"]}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, handler := newTestHttpServer()
+			server := httptest.NewServer(s)
+			defer server.Close()
+			defer s.Close()
+
+			var body io.Reader = strings.NewReader(test.body)
+			if test.chunked {
+				// the client sends a reader of which it does not know the length chunked
+				body = io.MultiReader(body)
+			}
+
+			response, err := http.Post(server.URL+test.path, "application/json", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+
+			if response.StatusCode != test.status {
+				t.Errorf("expected status %d, got %d", test.status, response.StatusCode)
+			}
+
+			var result ControlResponse
+			if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if result.OK != (test.status == http.StatusOK) {
+				t.Errorf("expected ok %t, got %+v", test.status == http.StatusOK, result)
+			}
+
+			requests := handler.actionRequests()
+			if test.request == nil {
+				if len(requests) != 0 {
+					t.Errorf("expected no request to the handler, got %+v", requests)
+				}
+				return
+			}
+			if len(requests) != 1 || !reflect.DeepEqual(requests[0], *test.request) {
+				t.Errorf("expected request %+v, got %+v", *test.request, requests)
+			}
+		})
+	}
+}
+
+func TestHttpServerCommandExecRejected(t *testing.T) {
+	s, handler := newTestHttpServer()
+	server := httptest.NewServer(s)
+	defer server.Close()
+	defer s.Close()
+
+	body := `{"command": "action", "action": "exec", "args": ["touch", "/tmp/owned"]}`
+	response, err := http.Post(server.URL+"/command", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, response.StatusCode)
+	}
+	if requests := handler.actionRequests(); len(requests) != 0 {
+		t.Errorf("expected no request to the handler, got %+v", requests)
+	}
+}
+
+func TestHttpServerHostAndOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		status int
+	}{
+		{name: "localhost", host: "localhost:8765", status: http.StatusOK},
+		{name: "ipv4 address", host: "127.0.0.1:8765", status: http.StatusOK},
+		{name: "ipv6 address", host: "[::1]:8765", status: http.StatusOK},
+		{name: "host without port", host: "localhost", status: http.StatusOK},
+		{name: "other name", host: "attacker.example:8765", status: http.StatusForbidden},
+		{name: "name resolving to localhost", host: "localhost.attacker.example:8765", status: http.StatusForbidden},
+		{name: "same origin", host: "localhost:8765", origin: "http://localhost:8765", status: http.StatusOK},
+		{name: "other origin", host: "localhost:8765", origin: "http://attacker.example", status: http.StatusForbidden},
+		{name: "other port", host: "localhost:8765", origin: "http://localhost:8080", status: http.StatusForbidden},
+		{name: "invalid origin", host: "localhost:8765", origin: "http://%zz", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, handler := newTestHttpServer()
+			defer s.Close()
+
+			request := httptest.NewRequest(http.MethodPost, "/actions/player.next", nil)
+			request.Host = test.host
+			if len(test.origin) != 0 {
+				request.Header.Set("Origin", test.origin)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Errorf("expected status %d, got %d", test.status, recorder.Code)
+			}
+			if requests := handler.actionRequests(); test.status == http.StatusForbidden && len(requests) != 0 {
+				t.Errorf("expected no request to the handler, got %+v", requests)
+			}
+		})
+	}
+}
+
+func TestHttpServerWebSocket(t *testing.T) {
+	s, handler := newTestHttpServer()
+	server := httptest.NewServer(s)
+	defer server.Close()
+	defer s.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// the client is subscribed once it received the first state
+	var state ControlState
+	if err := conn.ReadJSON(&state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Title != "Song" {
+		t.Errorf("expected title Song in the first state, got %+v", state)
+	}
+
+	// a change of only the position is not pushed, so the next state is that of the new track
+	handler.setState(func(state *ControlState) {
+		state.Position = 10
+	})
+	handler.setState(func(state *ControlState) {
+		state.Title = "Next Song"
+		state.Position = 0
+	})
+
+	if err := conn.ReadJSON(&state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Title != "Next Song" {
+		t.Errorf("expected title Next Song in the pushed state, got %+v", state)
+	}
+
+	// a state equal to the pushed one is not pushed again, closing the server closes the socket instead
+	handler.setState(func(state *ControlState) {})
+	s.Close()
+
+	if err := conn.ReadJSON(&state); err == nil {
+		t.Errorf("expected the socket to be closed, got %+v", state)
+	}
+}
+
+func TestHttpServerWebSocketOtherOrigin(t *testing.T) {
+	s, _ := newTestHttpServer()
+	server := httptest.NewServer(s)
+	defer server.Close()
+	defer s.Close()
+
+	header := http.Header{"Origin": []string{"http://attacker.example"}}
+	_, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err == nil {
+		t.Fatal("expected the connection to be refused")
+	}
+	if response == nil || response.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status %d, got %v", http.StatusForbidden, response)
+	}
+}
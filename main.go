@@ -1,27 +1,116 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"github.com/godbus/dbus"
+	"gitlab.com/gomidi/midi/mid"
 	"gitlab.com/gomidi/rtmididrv"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	drv, err := rtmididrv.New()
-	must(err)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [list-ports | ctl <command>]\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "ctl %s\n", ctlUsage)
+	}
+
+	configPath := flag.String("config", DefaultConfigPath(), "path to the configuration file")
+	profileName := flag.String("profile", "", "controller profile: x-touch-one, x-touch-mini, nanokontrol2 or lpd8")
+	mode := flag.String("mode", "", "protocol of the controller, for the x-touch-one: auto, standard or mcu")
+	portSpec := flag.String("port", "", "select the input and output port by name:, prefix:, regex: or index:")
+	inSpec := flag.String("in", "", "select the input port, overrides -port")
+	outSpec := flag.String("out", "", "select the output port, overrides -port")
+	simulate := flag.Bool("simulate", false, "use an X-Touch One simulated in the terminal instead of a MIDI device")
+	socketPath := flag.String("socket", "", "path of the control socket, an empty path disables it")
+	flag.Parse()
+
+	if flag.Arg(0) == "ctl" {
+		config, err := LoadConfig(*configPath, !isFlagSet("config"))
+		must(err)
+		if isFlagSet("socket") {
+			config.Control.Socket = *socketPath
+		}
+
+		err = RunCtl(config.Control.Socket, flag.Args()[1:], os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var drv mid.Driver
+	var simulator *Simulator
+	if *simulate {
+		simulator = NewSimulator()
+		drv = simulator.Driver()
+	} else {
+		rtmidiDriver, err := rtmididrv.New()
+		must(err)
+		drv = rtmidiDriver
+	}
 	defer drv.Close()
 
-	midiController := NewMidiController(drv, "X-Touch One")
-	must(midiController.OpenIn())
-	must(midiController.OpenOut())
-	defer midiController.Close()
+	switch flag.Arg(0) {
+	case "":
+	case "list-ports":
+		must(ListPorts(drv, os.Stdout))
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config, err := LoadConfig(*configPath, !isFlagSet("config"))
+	must(err)
+	// an empty -socket disables the socket, so it is not a fallback to the config like the other flags
+	if isFlagSet("socket") {
+		config.Control.Socket = *socketPath
+	}
 
-	must(midiController.Reset())
+	profile, err := GetControllerProfile(firstNonEmpty(*profileName, config.Device.Profile))
+	must(err)
+
+	if *simulate {
+		if profile.Name() != "x-touch-one" {
+			must(fmt.Errorf("the simulator only supports the x-touch-one profile"))
+		}
+		*mode = xTouchOneModeStandard
+		*inSpec = "name:" + simulatorPortName
+		*outSpec = "name:" + simulatorPortName
+	}
+
+	if modeName := firstNonEmpty(*mode, config.Device.Mode); len(modeName) != 0 {
+		selector, ok := profile.(ModeSelector)
+		if !ok {
+			must(fmt.Errorf("controller profile %s does not support modes", profile.Name()))
+		}
+		must(selector.SetMode(modeName))
+	}
+
+	if len(config.Bindings) == 0 {
+		config.Bindings, err = DefaultBindings(profile.Name())
+		must(err)
+	}
+
+	bindings, err := NewBindings(config.Bindings)
+	must(err)
+
+	inSelector, err := ParsePortSelector(firstNonEmpty(*inSpec, *portSpec, config.Device.In, profile.DefaultPort()))
+	must(err)
+	outSelector, err := ParsePortSelector(firstNonEmpty(*outSpec, *portSpec, config.Device.Out, profile.DefaultPort()))
+	must(err)
+
+	midiController := NewMidiController(drv, profile, inSelector, outSelector)
+	defer midiController.Close()
 	defer midiController.Reset()
 
 	sessionBus, err := dbus.SessionBus()
@@ -29,19 +118,66 @@ func main() {
 	defer sessionBus.Close()
 
 	playerMonitor := NewDbusMediaPlayerMonitor(sessionBus)
+	playerMonitor.SetFollowPlaying(config.Players.Follow)
+	playerMonitor.SetExclusivePlayback(config.Players.Exclusive, config.Players.ExclusiveExempt)
+	playerMonitor.SetOrder(config.Players.Order, config.Players.Priority)
+	if lastPlayerPath := DefaultLastPlayerPath(); config.Players.Remember && len(lastPlayerPath) != 0 {
+		playerMonitor.SetLastPlayerPath(lastPlayerPath)
+	}
 	must(playerMonitor.Init())
 
-	audioMixer := NewAudioMixer()
+	audioMixer := NewAudioMixer(config.Mixer)
 	must(audioMixer.Init())
 
-	eventHandler := NewEventHandler(midiController, playerMonitor, audioMixer)
+	volumeCurve, err := NewVolumeCurve(config.Mixer)
+	must(err)
+
+	eventHandler := NewEventHandler(midiController, playerMonitor, audioMixer, bindings, volumeCurve, config)
 
 	eventHandler.Setup()
+	go eventHandler.Run()
+	defer eventHandler.Close()
+
+	if len(config.Control.Socket) != 0 {
+		controlServer := NewControlServer(config.Control.Socket, eventHandler)
+		must(controlServer.Start())
+		defer controlServer.Close()
+	}
+
+	if config.Control.Dbus {
+		dbusService := NewDbusService(sessionBus, eventHandler)
+		must(dbusService.Start())
+		defer dbusService.Close()
+	}
+
+	if config.Players.Proxy {
+		mprisProxy := NewMprisProxy(sessionBus, eventHandler)
+		must(mprisProxy.Start())
+		defer mprisProxy.Close()
+	}
+
+	if config.Http.Enabled {
+		httpServer := NewHttpServer(eventHandler)
+		must(httpServer.Start(config.Http.Listen))
+		defer httpServer.Close()
+	}
+
+	go midiController.Supervise(2 * time.Second)
+
+	var done <-chan struct{}
+	if simulator != nil {
+		must(simulator.Start())
+		defer simulator.Stop()
+		done = simulator.Done()
+	}
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 
-	<-signals
+	select {
+	case <-signals:
+	case <-done:
+	}
 }
 
 func must(err error) {
@@ -49,3 +185,24 @@ func must(err error) {
 		panic(err.Error())
 	}
 }
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if len(value) != 0 {
+			return value
+		}
+	}
+
+	return ""
+}
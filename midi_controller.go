@@ -3,52 +3,56 @@ package main
 import (
 	"fmt"
 	"github.com/mozillazg/go-unidecode"
+	"gitlab.com/gomidi/midi"
 	"gitlab.com/gomidi/midi/mid"
+	"io"
 	"log"
-	"strings"
+	"sync"
+	"time"
 )
 
 type MidiController struct {
-	driver mid.Driver
-	name   string
-	in     mid.In
-	out    mid.Out
-	writer *mid.Writer
-	reader *mid.Reader
+	driver      mid.Driver
+	profile     ControllerProfile
+	inSelector  *PortSelector
+	outSelector *PortSelector
+	in          mid.In
+	out         mid.Out
+	writer      *mid.Writer
+	reader      *mid.Reader
+	mutex       sync.Mutex
+	// inName and outName are the names of the open ports, and writeFailed is set when writing to the output failed,
+	// which tell that the ports are stale
+	inName      string
+	outName     string
+	writeFailed bool
+
+	messageHandler func(msg midi.Message)
+	resetCallback  func()
 }
 
-func NewMidiController(driver mid.Driver, name string) *MidiController {
+func NewMidiController(driver mid.Driver, profile ControllerProfile, inSelector *PortSelector, outSelector *PortSelector) *MidiController {
 	return &MidiController{
-		driver: driver,
-		name:   name,
+		driver:      driver,
+		profile:     profile,
+		inSelector:  inSelector,
+		outSelector: outSelector,
 	}
 }
 
 const (
-	CcFader       uint8 = 70
-	CcLedRing     uint8 = 80
-	CcLedMeter    uint8 = 90
-	NoteEncoder   uint8 = 0
-	NoteTime      uint8 = 1
-	NotePrevious  uint8 = 20
-	NoteNext      uint8 = 21
-	NoteStop      uint8 = 22
-	NotePlay      uint8 = 23
-	NoteBankLeft  uint8 = 25
-	NoteBankRight uint8 = 26
-	NoteFader     uint8 = 110
-	ColorBlack    uint8 = 0
-	ColorRed      uint8 = 1
-	ColorGreen    uint8 = 2
-	ColorYellow   uint8 = 3
-	ColorBlue     uint8 = 4
-	ColorMagenta  uint8 = 5
-	ColorCyan     uint8 = 6
-	ColorWhite    uint8 = 7
-	InvertNone    uint8 = 0
-	InvertTop     uint8 = 1
-	InvertBottom  uint8 = 2
-	InvertBoth    uint8 = 3
+	ColorBlack   uint8 = 0
+	ColorRed     uint8 = 1
+	ColorGreen   uint8 = 2
+	ColorYellow  uint8 = 3
+	ColorBlue    uint8 = 4
+	ColorMagenta uint8 = 5
+	ColorCyan    uint8 = 6
+	ColorWhite   uint8 = 7
+	InvertNone   uint8 = 0
+	InvertTop    uint8 = 1
+	InvertBottom uint8 = 2
+	InvertBoth   uint8 = 3
 )
 
 func (c *MidiController) OpenOut() error {
@@ -59,23 +63,26 @@ func (c *MidiController) OpenOut() error {
 	}
 
 	for _, out := range outs {
-		if strings.HasPrefix(out.String(), c.name) {
+		if c.outSelector.Match(out.Number(), out.String()) {
 			log.Printf("opening out port with name %s\n", out.String())
-			c.out = out
 
-			err := c.out.Open()
+			err := out.Open()
 			if err != nil {
 				return err
 			}
 
+			c.mutex.Lock()
+			c.out = out
+			c.outName = out.String()
 			c.writer = mid.ConnectOut(c.out)
 			c.writer.ConsolidateNotes(false)
+			c.mutex.Unlock()
 
 			return nil
 		}
 	}
 
-	return fmt.Errorf("no midi output found starting with name %s", c.name)
+	return fmt.Errorf("no midi output found matching %s", c.outSelector)
 }
 
 func (c *MidiController) OpenIn() error {
@@ -86,75 +93,348 @@ func (c *MidiController) OpenIn() error {
 	}
 
 	for _, in := range ins {
-		if strings.HasPrefix(in.String(), c.name) {
+		if c.inSelector.Match(in.Number(), in.String()) {
 			log.Printf("opening in port with name %s\n", in.String())
-			c.in = in
 
-			err := c.in.Open()
+			err := in.Open()
 			if err != nil {
 				return err
 			}
 
-			c.reader = mid.NewReader(mid.NoLogger())
+			reader := mid.NewReader(mid.NoLogger())
+			reader.Msg.Each = c.handleMessage
+
+			c.mutex.Lock()
+			c.in = in
+			c.inName = in.String()
+			c.reader = reader
+			c.mutex.Unlock()
 
-			return mid.ConnectIn(c.in, c.reader)
+			return mid.ConnectIn(in, reader)
 		}
 	}
 
-	return fmt.Errorf("no midi input found starting with name %s", c.name)
+	return fmt.Errorf("no midi input found matching %s", c.inSelector)
+}
+
+func ListPorts(driver mid.Driver, w io.Writer) error {
+	ins, err := driver.Ins()
+	if err != nil {
+		return err
+	}
+
+	outs, err := driver.Outs()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "Inputs:")
+	for _, in := range ins {
+		fmt.Fprintf(w, "  %d: %s\n", in.Number(), in.String())
+	}
+
+	fmt.Fprintln(w, "Outputs:")
+	for _, out := range outs {
+		fmt.Fprintf(w, "  %d: %s\n", out.Number(), out.String())
+	}
+
+	return nil
 }
 
 func (c *MidiController) Close() error {
-	if c.in != nil {
-		c.in.Close()
+	c.mutex.Lock()
+	in, out := c.in, c.out
+	c.in, c.out = nil, nil
+	c.reader, c.writer = nil, nil
+	c.inName, c.outName = "", ""
+	c.writeFailed = false
+	c.mutex.Unlock()
+
+	// the ports are closed without holding the lock, as closing the input waits for a running message handler
+	if in != nil {
+		in.Close()
 	}
-	if c.out != nil {
-		c.out.Close()
+	if out != nil {
+		out.Close()
 	}
 
 	return nil
 }
 
-func (c *MidiController) Reset() error {
-	for n := uint8(1); n <= 35; n++ {
-		err := c.writer.NoteOn(n, 0)
+func (c *MidiController) Connected() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.in != nil && c.out != nil
+}
+
+// Supervise keeps the controller connected. It opens the ports when they appear, closes them when they disappear and
+// reopens them when they became stale. After every connect the controller is reset and the reset callback is called to
+// restore its state.
+func (c *MidiController) Supervise(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for {
+		c.checkConnection()
+		<-ticker.C
+	}
+}
+
+func (c *MidiController) checkConnection() {
+	inName, outName, err := c.findPorts()
+	if err != nil {
+		log.Printf("error while listing midi ports: %v", err)
+		return
+	}
+
+	present := len(inName) != 0 && len(outName) != 0
+	connected := c.Connected()
+
+	if connected && !present {
+		log.Printf("controller disconnected")
+		c.Close()
+	}
+
+	// a device which was replugged between two checks is present, but the open ports are gone with the old device
+	if connected && present && c.stale(inName, outName) {
+		log.Printf("controller was replugged")
+		c.Close()
+		connected = false
+	}
+
+	if !connected && present {
+		err := c.connect()
 		if err != nil {
-			return err
+			log.Printf("error while connecting controller: %v", err)
+			c.Close()
+			return
+		}
+
+		log.Printf("controller connected")
+
+		if detector, ok := c.profile.(ModeDetector); ok {
+			c.mutex.Lock()
+			detector.ResetDetection()
+			c.mutex.Unlock()
+		}
+
+		c.logError(c.Reset())
+		if c.resetCallback != nil {
+			c.resetCallback()
 		}
 	}
+}
 
-	c.writer.ControlChange(CcFader, 0)
-	c.writer.ControlChange(CcLedRing, 64)
-	c.writer.ControlChange(CcLedMeter, 0)
+func (c *MidiController) connect() error {
+	err := c.OpenIn()
+	if err != nil {
+		return err
+	}
 
-	c.writer.SysEx(c.CreateSegmentDisplayData(EmptySegmentDisplayData()))
-	c.writer.SysEx(c.CreateLcdDisplayData("", ColorBlack, InvertNone))
+	return c.OpenOut()
+}
 
-	return nil
+// findPorts returns the names of the ports matching the selectors, which are empty when a port is not present. Like
+// OpenIn and OpenOut, the first matching port is used.
+func (c *MidiController) findPorts() (string, string, error) {
+	ins, err := c.driver.Ins()
+	if err != nil {
+		return "", "", err
+	}
+
+	outs, err := c.driver.Outs()
+	if err != nil {
+		return "", "", err
+	}
+
+	inName := ""
+	for _, in := range ins {
+		if c.inSelector.Match(in.Number(), in.String()) {
+			inName = in.String()
+			break
+		}
+	}
+
+	outName := ""
+	for _, out := range outs {
+		if c.outSelector.Match(out.Number(), out.String()) {
+			outName = out.String()
+			break
+		}
+	}
+
+	return inName, outName, nil
+}
+
+// stale tells whether the open ports do not belong to the present device anymore: the matching ports have other
+// names, or writing to the output failed
+func (c *MidiController) stale(inName string, outName string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.writeFailed || c.inName != inName || c.outName != outName
+}
+
+func (c *MidiController) Reset() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.writer == nil {
+		return nil
+	}
+
+	return c.writeError(c.profile.Reset(c.writer))
+}
+
+func (c *MidiController) SetMessageHandler(handler func(msg midi.Message)) {
+	c.messageHandler = handler
+}
+
+// SetOnResetCallback sets the callback which is called when the controller was (re)connected or reset by itself, and
+// needs to be sent its complete state again
+func (c *MidiController) SetOnResetCallback(callback func()) {
+	c.resetCallback = callback
+}
+
+func (c *MidiController) handleMessage(pos *mid.Position, msg midi.Message) {
+	// the detected mode is used by the writes, so it is changed while holding the lock
+	c.mutex.Lock()
+	detected := false
+	if detector, ok := c.profile.(ModeDetector); ok {
+		detected = detector.DetectMode(msg)
+	}
+	if translator, ok := c.profile.(InputTranslator); ok {
+		msg = translator.TranslateInput(msg)
+	}
+	c.mutex.Unlock()
+
+	if detected {
+		c.logError(c.Reset())
+		if c.resetCallback != nil {
+			c.resetCallback()
+		}
+	}
+
+	if msg == nil {
+		return
+	}
+
+	if c.messageHandler != nil {
+		c.messageHandler(msg)
+	}
+}
+
+func (c *MidiController) SetNoteLed(note uint8, on bool) {
+	if leds, ok := c.profile.(ButtonLeds); ok {
+		c.write(func(w *mid.Writer) error {
+			return leds.SetNoteLed(w, note, on)
+		})
+	}
+}
+
+func (c *MidiController) SetControlLed(controller uint8, on bool) {
+	if leds, ok := c.profile.(ButtonLeds); ok {
+		c.write(func(w *mid.Writer) error {
+			return leds.SetControlLed(w, controller, on)
+		})
+	}
 }
 
-func (c *MidiController) CreateLcdDisplayData(characters string, color uint8, invert uint8) []byte {
-	data := make([]byte, 14)
-	copy(data, unidecode.Unidecode(characters))
+func (c *MidiController) SetFader(controller uint8, value uint8) {
+	if fader, ok := c.profile.(MotorFader); ok {
+		c.write(func(w *mid.Writer) error {
+			return fader.SetFader(w, controller, value)
+		})
+	}
+}
+
+func (c *MidiController) SetLedRing(controller uint8, value uint8) {
+	if ring, ok := c.profile.(LedRing); ok {
+		c.write(func(w *mid.Writer) error {
+			return ring.SetLedRing(w, controller, value)
+		})
+	}
+}
+
+func (c *MidiController) SetLedMeter(value uint8) {
+	if meter, ok := c.profile.(LedMeter); ok {
+		c.write(func(w *mid.Writer) error {
+			return meter.SetLedMeter(w, value)
+		})
+	}
+}
 
-	colorCode := color | (invert << 4)
+// TextSize returns the size of the text display, or zero when the controller has none
+func (c *MidiController) TextSize() (int, int) {
+	if display, ok := c.profile.(TextDisplay); ok {
+		return display.TextSize()
+	}
+
+	return 0, 0
+}
+
+func (c *MidiController) ShowText(text string, color uint8, invert uint8) {
+	if display, ok := c.profile.(TextDisplay); ok {
+		c.write(func(w *mid.Writer) error {
+			return display.ShowText(w, text, color, invert)
+		})
+	}
+}
+
+// SegmentDigits returns the number of digits of the segment display, or zero when the controller has none
+func (c *MidiController) SegmentDigits() int {
+	if display, ok := c.profile.(SegmentDisplay); ok {
+		return display.SegmentDigits()
+	}
 
-	return append([]byte{0x00, 0x20, 0x32, 0x41, 0x4c, 0x00, colorCode}, data...)
+	return 0
 }
 
-func (c *MidiController) CreateSegmentDisplayData(data SegmentDisplayData) []byte {
-	return append([]byte{0x00, 0x20, 0x32, 0x41, 0x37}, append(data.text, data.dots...)...)
+func (c *MidiController) ShowSegments(data SegmentDisplayData) {
+	if display, ok := c.profile.(SegmentDisplay); ok {
+		c.write(func(w *mid.Writer) error {
+			return display.ShowSegments(w, data)
+		})
+	}
+}
+
+// write runs f with the writer of the output port, or does nothing while the controller is disconnected
+func (c *MidiController) write(f func(w *mid.Writer) error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.writer == nil {
+		return
+	}
+
+	c.logError(c.writeError(f(c.writer)))
+}
+
+// writeError remembers that writing failed, so the next check reconnects the controller. The lock has to be held.
+func (c *MidiController) writeError(err error) error {
+	if err != nil {
+		c.writeFailed = true
+	}
+
+	return err
+}
+
+func (c *MidiController) logError(err error) {
+	if err != nil {
+		log.Printf("error while writing to %s: %v", c.profile.Name(), err)
+	}
 }
 
 type SegmentDisplayData struct {
-	text []byte
-	dots []byte
+	chars []byte
+	text  []byte
+	dots  []byte
 }
 
 func EmptySegmentDisplayData() SegmentDisplayData {
 	return SegmentDisplayData{
-		text: make([]byte, 12),
-		dots: make([]byte, 2),
+		chars: make([]byte, 12),
+		text:  make([]byte, 12),
+		dots:  make([]byte, 2),
 	}
 }
 
@@ -163,8 +443,9 @@ func NewSegmentDisplayData(text string) SegmentDisplayData {
 	copy(textBytes, unidecode.Unidecode(text))
 
 	return SegmentDisplayData{
-		text: lcd7bitRender(textBytes),
-		dots: lcd7bitRenderDots(textBytes),
+		chars: textBytes,
+		text:  lcd7bitRender(textBytes),
+		dots:  lcd7bitRenderDots(textBytes),
 	}
 }
 
@@ -173,7 +454,8 @@ func NewSegmentDisplayDataTime(text string) SegmentDisplayData {
 	copy(textBytes, unidecode.Unidecode(text))
 
 	return SegmentDisplayData{
-		text: lcd7bitRender(textBytes),
-		dots: []byte{0x50, 0x00},
+		chars: textBytes,
+		text:  lcd7bitRender(textBytes),
+		dots:  []byte{0x50, 0x00},
 	}
 }
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+	"reflect"
+	"time"
+)
+
+const (
+	mprisProxyName     = mediaPlayerPrefix + "midicontroller"
+	mprisProxyIdentity = "MIDI Media Controller"
+	mprisNoTrack       = dbus.ObjectPath("/org/mpris/MediaPlayer2/TrackList/NoTrack")
+)
+
+// MprisProxy exports an MPRIS player which forwards to the active player and mirrors its state, so desktop media keys
+// and panel widgets follow the player selected with the controller
+type MprisProxy struct {
+	bus     *dbus.Conn
+	handler *EventHandler
+	// properties and player are the properties of the player interface and the player last announced, owned by the
+	// event loop
+	properties map[string]dbus.Variant
+	player     *DbusMediaPlayer
+}
+
+func NewMprisProxy(bus *dbus.Conn, handler *EventHandler) *MprisProxy {
+	return &MprisProxy{
+		bus:     bus,
+		handler: handler,
+	}
+}
+
+// Start exports the player and requests its name, the event loop has to be running
+func (p *MprisProxy) Start() error {
+	node := &introspect.Node{
+		Name: mprisPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			dbusPropertiesIntrospectData,
+			{
+				Name:    mprisName,
+				Methods: []introspect.Method{{Name: "Raise"}, {Name: "Quit"}},
+				Properties: []introspect.Property{
+					{Name: "CanQuit", Type: "b", Access: "read"},
+					{Name: "CanRaise", Type: "b", Access: "read"},
+					{Name: "HasTrackList", Type: "b", Access: "read"},
+					{Name: "Identity", Type: "s", Access: "read"},
+					{Name: "SupportedUriSchemes", Type: "as", Access: "read"},
+					{Name: "SupportedMimeTypes", Type: "as", Access: "read"},
+				},
+			},
+			{
+				Name: mprisPlayerName,
+				Methods: []introspect.Method{
+					{Name: "Next"},
+					{Name: "Previous"},
+					{Name: "Pause"},
+					{Name: "PlayPause"},
+					{Name: "Stop"},
+					{Name: "Play"},
+					{Name: "Seek", Args: []introspect.Arg{{Name: "Offset", Type: "x", Direction: "in"}}},
+					{Name: "SetPosition", Args: []introspect.Arg{
+						{Name: "TrackId", Type: "o", Direction: "in"},
+						{Name: "Position", Type: "x", Direction: "in"},
+					}},
+					{Name: "OpenUri", Args: []introspect.Arg{{Name: "Uri", Type: "s", Direction: "in"}}},
+				},
+				Signals: []introspect.Signal{{Name: "Seeked", Args: []introspect.Arg{{Name: "Position", Type: "x"}}}},
+				Properties: []introspect.Property{
+					{Name: "PlaybackStatus", Type: "s", Access: "read"},
+					{Name: "Rate", Type: "d", Access: "read"},
+					{Name: "Metadata", Type: "a{sv}", Access: "read"},
+					{Name: "Position", Type: "x", Access: "read"},
+					{Name: "MinimumRate", Type: "d", Access: "read"},
+					{Name: "MaximumRate", Type: "d", Access: "read"},
+					{Name: "CanGoNext", Type: "b", Access: "read"},
+					{Name: "CanGoPrevious", Type: "b", Access: "read"},
+					{Name: "CanPlay", Type: "b", Access: "read"},
+					{Name: "CanPause", Type: "b", Access: "read"},
+					{Name: "CanSeek", Type: "b", Access: "read"},
+					{Name: "CanControl", Type: "b", Access: "read"},
+				},
+			},
+		},
+	}
+
+	err := p.bus.Export(introspect.NewIntrospectable(node), mprisPath, "org.freedesktop.DBus.Introspectable")
+	if err == nil {
+		err = p.bus.Export(mprisProxyProperties{p}, mprisPath, propertiesIface)
+	}
+	if err == nil {
+		err = p.bus.Export(mprisProxyRoot{}, mprisPath, mprisName)
+	}
+	if err == nil {
+		// Seek is named SeekBy in Go, as vet expects a Seek method to implement io.Seeker
+		err = p.bus.ExportWithMap(mprisProxyPlayer{p}, map[string]string{"SeekBy": "Seek"}, mprisPath, mprisPlayerName)
+	}
+	if err != nil {
+		return fmt.Errorf("error while exporting the mpris proxy: %v", err)
+	}
+
+	p.handler.call(func() {
+		p.properties = p.readPlayerProperties()
+		p.player = p.handler.player
+		p.handler.AddStateChangeCallback(p.update)
+		p.handler.AddSeekedCallback(p.emitSeeked)
+	})
+
+	reply, err := p.bus.RequestName(mprisProxyName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return fmt.Errorf("error while requesting d-bus name %s: %v", mprisProxyName, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("d-bus name %s is owned by another instance", mprisProxyName)
+	}
+
+	return nil
+}
+
+func (p *MprisProxy) Close() error {
+	_, err := p.bus.ReleaseName(mprisProxyName)
+
+	return err
+}
+
+func (p *MprisProxy) readRootProperties() map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"CanQuit":             dbus.MakeVariant(false),
+		"CanRaise":            dbus.MakeVariant(false),
+		"HasTrackList":        dbus.MakeVariant(false),
+		"Identity":            dbus.MakeVariant(mprisProxyIdentity),
+		"SupportedUriSchemes": dbus.MakeVariant([]string{}),
+		"SupportedMimeTypes":  dbus.MakeVariant([]string{}),
+	}
+}
+
+// readPlayerProperties returns the properties of the active player, or of a stopped player without a track when
+// there is none
+func (p *MprisProxy) readPlayerProperties() map[string]dbus.Variant {
+	player := p.handler.player
+
+	status := "Stopped"
+	metadata := map[string]dbus.Variant{"mpris:trackid": dbus.MakeVariant(mprisNoTrack)}
+	rate := 1.0
+	position := time.Duration(0)
+
+	if player != nil {
+		switch player.playbackStatus {
+		case "Playing", "Paused":
+			status = player.playbackStatus
+		}
+		if len(player.metadata) != 0 {
+			metadata = player.metadata
+		}
+		rate = player.rate
+		position = player.Position()
+	}
+
+	return map[string]dbus.Variant{
+		"PlaybackStatus": dbus.MakeVariant(status),
+		"Rate":           dbus.MakeVariant(rate),
+		"Metadata":       dbus.MakeVariant(metadata),
+		"Position":       dbus.MakeVariant(int64(position / time.Microsecond)),
+		"MinimumRate":    dbus.MakeVariant(1.0),
+		"MaximumRate":    dbus.MakeVariant(1.0),
+		"CanGoNext":      dbus.MakeVariant(player != nil),
+		"CanGoPrevious":  dbus.MakeVariant(player != nil),
+		"CanPlay":        dbus.MakeVariant(player != nil),
+		"CanPause":       dbus.MakeVariant(player != nil),
+		"CanSeek":        dbus.MakeVariant(player != nil),
+		"CanControl":     dbus.MakeVariant(true),
+	}
+}
+
+// update announces the properties which changed since the last update. The position is not announced, as it changes
+// continuously; a jump of the position, like after another player was selected, is announced with Seeked.
+func (p *MprisProxy) update() {
+	properties := p.readPlayerProperties()
+
+	changed := make(map[string]dbus.Variant)
+	for name, value := range properties {
+		if name != "Position" && !reflect.DeepEqual(value, p.properties[name]) {
+			changed[name] = value
+		}
+	}
+	p.properties = properties
+
+	if len(changed) != 0 {
+		p.bus.Emit(mprisPath, propertiesChanged, mprisPlayerName, changed, []string{})
+	}
+
+	if p.handler.player != p.player {
+		p.player = p.handler.player
+		p.bus.Emit(mprisPath, seeked, properties["Position"].Value())
+	}
+}
+
+func (p *MprisProxy) emitSeeked(position time.Duration) {
+	p.bus.Emit(mprisPath, seeked, int64(position/time.Microsecond))
+}
+
+// forward runs f with the active player on the event loop, it does nothing when there is no active player
+func (p *MprisProxy) forward(f func(player *DbusMediaPlayer)) *dbus.Error {
+	if !p.handler.call(func() {
+		if p.handler.player != nil {
+			f(p.handler.player)
+		}
+	}) {
+		return dbus.NewError(errorFailed, []interface{}{"the controller is shutting down"})
+	}
+
+	return nil
+}
+
+// mprisProxyRoot is the org.mpris.MediaPlayer2 interface, the proxy has no window and cannot be quit
+type mprisProxyRoot struct{}
+
+func (mprisProxyRoot) Raise() *dbus.Error {
+	return nil
+}
+
+func (mprisProxyRoot) Quit() *dbus.Error {
+	return nil
+}
+
+// mprisProxyPlayer is the org.mpris.MediaPlayer2.Player interface, which forwards to the active player
+type mprisProxyPlayer struct {
+	p *MprisProxy
+}
+
+func (m mprisProxyPlayer) Next() *dbus.Error {
+	return m.p.forward((*DbusMediaPlayer).Next)
+}
+
+func (m mprisProxyPlayer) Previous() *dbus.Error {
+	return m.p.forward((*DbusMediaPlayer).Previous)
+}
+
+func (m mprisProxyPlayer) Pause() *dbus.Error {
+	return m.p.forward((*DbusMediaPlayer).Pause)
+}
+
+func (m mprisProxyPlayer) PlayPause() *dbus.Error {
+	return m.p.forward((*DbusMediaPlayer).PlayPause)
+}
+
+func (m mprisProxyPlayer) Stop() *dbus.Error {
+	return m.p.forward((*DbusMediaPlayer).Stop)
+}
+
+func (m mprisProxyPlayer) Play() *dbus.Error {
+	return m.p.forward((*DbusMediaPlayer).Play)
+}
+
+func (m mprisProxyPlayer) SeekBy(offset int64) *dbus.Error {
+	return m.p.forward(func(player *DbusMediaPlayer) {
+		player.Seek(time.Duration(offset) * time.Microsecond)
+	})
+}
+
+func (m mprisProxyPlayer) SetPosition(trackID dbus.ObjectPath, position int64) *dbus.Error {
+	return m.p.forward(func(player *DbusMediaPlayer) {
+		player.SetPosition(trackID, time.Duration(position)*time.Microsecond)
+	})
+}
+
+func (m mprisProxyPlayer) OpenUri(uri string) *dbus.Error {
+	return m.p.forward(func(player *DbusMediaPlayer) {
+		player.OpenUri(uri)
+	})
+}
+
+// mprisProxyProperties implements org.freedesktop.DBus.Properties for both MPRIS interfaces, of which all
+// properties are read-only
+type mprisProxyProperties struct {
+	p *MprisProxy
+}
+
+func (m mprisProxyProperties) Get(iface string, name string) (dbus.Variant, *dbus.Error) {
+	properties, err := m.GetAll(iface)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+
+	value, ok := properties[name]
+	if !ok {
+		return dbus.Variant{}, dbus.NewError(errorUnknownProperty, []interface{}{"unknown property " + name})
+	}
+
+	return value, nil
+}
+
+func (m mprisProxyProperties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	switch iface {
+	case mprisName:
+		return m.p.readRootProperties(), nil
+	case mprisPlayerName:
+		var properties map[string]dbus.Variant
+		if !m.p.handler.call(func() {
+			properties = m.p.readPlayerProperties()
+		}) {
+			return nil, dbus.NewError(errorFailed, []interface{}{"the controller is shutting down"})
+		}
+		return properties, nil
+	}
+
+	return nil, dbus.NewError(errorUnknownInterface, []interface{}{"unknown interface " + iface})
+}
+
+func (m mprisProxyProperties) Set(iface string, name string, value dbus.Variant) *dbus.Error {
+	if _, err := m.Get(iface, name); err != nil {
+		return err
+	}
+
+	return dbus.NewError(errorPropertyReadOnly, []interface{}{"property " + name + " is read-only"})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultSource = "@DEFAULT_SOURCE@"
+
+// pactl runs pactl for the features the mafik/pulseaudio client does not offer, and returns its output. It runs in the
+// C locale, as the output which is not JSON is translated.
+func pactl(args ...string) ([]byte, error) {
+	cmd := exec.Command("pactl", args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error while running pactl %s: %v", strings.Join(args, " "), err)
+	}
+
+	return output, nil
+}
+
+func GetSourceMute() (bool, error) {
+	return getMute("get-source-mute", defaultSource)
+}
+
+func SetSourceMute(muted bool) error {
+	_, err := pactl("set-source-mute", defaultSource, pactlBool(muted))
+
+	return err
+}
+
+func GetSinkMute(name string) (bool, error) {
+	return getMute("get-sink-mute", name)
+}
+
+func SetSinkMute(name string, muted bool) error {
+	_, err := pactl("set-sink-mute", name, pactlBool(muted))
+
+	return err
+}
+
+func getMute(command string, name string) (bool, error) {
+	output, err := pactl(command, name)
+	if err != nil {
+		return false, err
+	}
+
+	return parseMute(output)
+}
+
+// parseMute reads the output of get-sink-mute and get-source-mute, like "Mute: yes"
+func parseMute(output []byte) (bool, error) {
+	switch strings.TrimSpace(string(output)) {
+	case "Mute: yes":
+		return true, nil
+	case "Mute: no":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unexpected mute in the output of pactl: %q", output)
+}
+
+// pactlVolumeRegexp matches the raw volume of every channel in the output of get-source-volume
+var pactlVolumeRegexp = regexp.MustCompile(`:\s*(\d+)\s*/`)
+
+type Sink struct {
+	Index       int    `json:"index"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func ListSinks() ([]Sink, error) {
+	output, err := pactl("-f", "json", "list", "sinks")
+	if err != nil {
+		return nil, err
+	}
+
+	var sinks []Sink
+	err = json.Unmarshal(output, &sinks)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading sinks: %v", err)
+	}
+
+	return sinks, nil
+}
+
+// SourceOutput is a recording stream of an application
+type SourceOutput struct {
+	Index      int               `json:"index"`
+	Properties map[string]string `json:"properties"`
+}
+
+func ListSourceOutputs() ([]SourceOutput, error) {
+	output, err := pactl("-f", "json", "list", "source-outputs")
+	if err != nil {
+		return nil, err
+	}
+
+	var sourceOutputs []SourceOutput
+	err = json.Unmarshal(output, &sourceOutputs)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading source outputs: %v", err)
+	}
+
+	return sourceOutputs, nil
+}
+
+// MatchesApplication returns true when the application name, process binary or media name of the stream is one of
+// the given names, ignoring case
+func (o *SourceOutput) MatchesApplication(names []string) bool {
+	for _, name := range names {
+		for _, property := range []string{"application.name", "application.process.binary", "media.name"} {
+			if strings.EqualFold(o.Properties[property], name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func SetDefaultSink(name string) error {
+	_, err := pactl("set-default-sink", name)
+
+	return err
+}
+
+func MoveSinkInput(index int, sink string) error {
+	_, err := pactl("move-sink-input", strconv.Itoa(index), sink)
+
+	return err
+}
+
+func GetSinkVolume(name string) (float32, error) {
+	return getVolume("get-sink-volume", name)
+}
+
+// GetSourceVolume returns the volume of the loudest channel of the default source
+func GetSourceVolume() (float32, error) {
+	return getVolume("get-source-volume", defaultSource)
+}
+
+func getVolume(command string, name string) (float32, error) {
+	output, err := pactl(command, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseVolume(output)
+}
+
+// parseVolume reads the volume of the loudest channel from the output of get-sink-volume and get-source-volume, like
+// "Volume: front-left: 39321 /  60% / -13.31 dB,   front-right: 39321 /  60% / -13.31 dB"
+func parseVolume(output []byte) (float32, error) {
+	matches := pactlVolumeRegexp.FindAllStringSubmatch(string(output), -1)
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("unexpected volume in the output of pactl: %q", output)
+	}
+
+	volume := 0
+	for _, match := range matches {
+		value, err := strconv.Atoi(match[1])
+		if err != nil {
+			return 0, fmt.Errorf("unexpected volume in the output of pactl: %q", output)
+		}
+		if value > volume {
+			volume = value
+		}
+	}
+
+	return float32(volume) / pulseVolumeNorm, nil
+}
+
+func SetSourceVolume(volume float32) error {
+	_, err := pactl("set-source-volume", defaultSource, strconv.Itoa(int(volume*pulseVolumeNorm)))
+
+	return err
+}
+
+func pactlBool(value bool) string {
+	if value {
+		return "1"
+	}
+
+	return "0"
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMute(t *testing.T) {
+	tests := []struct {
+		output string
+		muted  bool
+		// err is a part of the expected error, the output is valid when it is empty
+		err string
+	}{
+		{output: "Mute: yes\n", muted: true},
+		{output: "Mute: no\n", muted: false},
+		{output: "Mute: no", muted: false},
+		{output: "Stumm: ja\n", err: "unexpected mute"},
+		{output: "", err: "unexpected mute"},
+	}
+
+	for _, test := range tests {
+		muted, err := parseMute([]byte(test.output))
+
+		if len(test.err) != 0 {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: expected error containing %q, got %v", test.output, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: expected no error, got %v", test.output, err)
+		}
+		if muted != test.muted {
+			t.Errorf("%q: expected muted %t, got %t", test.output, test.muted, muted)
+		}
+	}
+}
+
+func TestParseVolume(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		volume float32
+		// err is a part of the expected error, the output is valid when it is empty
+		err string
+	}{
+		{
+			name: "stereo sink",
+			output: "Volume: front-left: 39321 /  60% / -13.31 dB,   front-right: 39321 /  60% / -13.31 dB\n" +
+				"        balance 0.00\n",
+			volume: 39321.0 / pulseVolumeNorm,
+		},
+		{
+			name: "channels with different volumes",
+			output: "Volume: front-left: 32768 /  50% / -18.06 dB,   front-right: 65536 / 100% / 0.00 dB\n" +
+				"        balance 0.50\n",
+			volume: 1,
+		},
+		{
+			name:   "mono source",
+			output: "Volume: mono: 65536 / 100% / 0.00 dB\n        balance 0.00\n",
+			volume: 1,
+		},
+		{
+			name:   "amplified source",
+			output: "Volume: mono: 98304 / 150% / 10.57 dB\n        balance 0.00\n",
+			volume: 1.5,
+		},
+		{
+			name:   "muted to zero",
+			output: "Volume: mono:     0 /   0% / -inf dB\n        balance 0.00\n",
+			volume: 0,
+		},
+		{
+			name:   "unexpected output",
+			output: "Volume: unknown\n",
+			err:    "unexpected volume",
+		},
+		{
+			name: "empty output",
+			err:  "unexpected volume",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			volume, err := parseVolume([]byte(test.output))
+
+			if len(test.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if volume != test.volume {
+				t.Errorf("expected volume %v, got %v", test.volume, volume)
+			}
+		})
+	}
+}
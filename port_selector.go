@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	portSelectName   = "name"
+	portSelectPrefix = "prefix"
+	portSelectRegex  = "regex"
+	portSelectIndex  = "index"
+)
+
+// PortSelector picks a MIDI port by exact name, name prefix, regular expression or port number
+type PortSelector struct {
+	kind   string
+	value  string
+	regexp *regexp.Regexp
+	index  int
+}
+
+// ParsePortSelector parses selectors in the form "kind:value", where kind is name, prefix, regex or index.
+// A selector without a kind is treated as a prefix.
+func ParsePortSelector(spec string) (*PortSelector, error) {
+	kind, value := portSelectPrefix, spec
+	if i := strings.Index(spec, ":"); i != -1 {
+		switch spec[:i] {
+		case portSelectName, portSelectPrefix, portSelectRegex, portSelectIndex:
+			kind, value = spec[:i], spec[i+1:]
+		}
+	}
+
+	if len(value) == 0 {
+		return nil, fmt.Errorf("empty port selector %q", spec)
+	}
+
+	s := &PortSelector{kind: kind, value: value}
+
+	switch kind {
+	case portSelectRegex:
+		r, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port regex %q: %v", value, err)
+		}
+		s.regexp = r
+	case portSelectIndex:
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid port index %q", value)
+		}
+		s.index = index
+	}
+
+	return s, nil
+}
+
+func (s *PortSelector) Match(number int, name string) bool {
+	switch s.kind {
+	case portSelectName:
+		return name == s.value
+	case portSelectRegex:
+		return s.regexp.MatchString(name)
+	case portSelectIndex:
+		return number == s.index
+	default:
+		return strings.HasPrefix(name, s.value)
+	}
+}
+
+func (s *PortSelector) String() string {
+	return s.kind + ":" + s.value
+}
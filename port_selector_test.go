@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePortSelector(t *testing.T) {
+	tests := []struct {
+		spec   string
+		string string
+		// err is a part of the expected error, the selector is valid when it is empty
+		err string
+	}{
+		{spec: "X-TOUCH ONE", string: "prefix:X-TOUCH ONE"},
+		{spec: "prefix:X-TOUCH", string: "prefix:X-TOUCH"},
+		{spec: "name:X-TOUCH ONE:X-TOUCH ONE MIDI 1 28:0", string: "name:X-TOUCH ONE:X-TOUCH ONE MIDI 1 28:0"},
+		{spec: "regex:^X-TOUCH (ONE|MINI)", string: "regex:^X-TOUCH (ONE|MINI)"},
+		{spec: "index:2", string: "index:2"},
+		{spec: "X-TOUCH ONE:X-TOUCH ONE MIDI 1", string: "prefix:X-TOUCH ONE:X-TOUCH ONE MIDI 1"},
+		{spec: "", err: "empty port selector"},
+		{spec: "name:", err: "empty port selector"},
+		{spec: "regex:(", err: "invalid port regex"},
+		{spec: "index:one", err: "invalid port index"},
+		{spec: "index:-1", err: "invalid port index"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			selector, err := ParsePortSelector(test.spec)
+
+			if len(test.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if selector.String() != test.string {
+				t.Errorf("expected selector %s, got %s", test.string, selector)
+			}
+		})
+	}
+}
+
+func TestPortSelectorMatch(t *testing.T) {
+	tests := []struct {
+		spec   string
+		number int
+		name   string
+		match  bool
+	}{
+		{spec: "X-TOUCH", number: 1, name: "X-TOUCH ONE:X-TOUCH ONE MIDI 1 28:0", match: true},
+		{spec: "X-TOUCH", number: 1, name: "Midi Through:Midi Through Port-0 14:0", match: false},
+		{spec: "prefix:X-TOUCH ONE", number: 1, name: "X-TOUCH ONE:X-TOUCH ONE MIDI 1 28:0", match: true},
+		{spec: "prefix:ONE", number: 1, name: "X-TOUCH ONE:X-TOUCH ONE MIDI 1 28:0", match: false},
+		{spec: "name:X-TOUCH ONE", number: 1, name: "X-TOUCH ONE", match: true},
+		{spec: "name:X-TOUCH ONE", number: 1, name: "X-TOUCH ONE:X-TOUCH ONE MIDI 1 28:0", match: false},
+		{spec: "regex:MIDI 1 \\d+:0$", number: 1, name: "X-TOUCH ONE:X-TOUCH ONE MIDI 1 28:0", match: true},
+		{spec: "regex:^ONE", number: 1, name: "X-TOUCH ONE:X-TOUCH ONE MIDI 1 28:0", match: false},
+		{spec: "index:1", number: 1, name: "X-TOUCH ONE", match: true},
+		{spec: "index:1", number: 0, name: "X-TOUCH ONE", match: false},
+		{spec: "index:0", number: 0, name: "Midi Through", match: true},
+	}
+
+	for _, test := range tests {
+		selector, err := ParsePortSelector(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if match := selector.Match(test.number, test.name); match != test.match {
+			t.Errorf("expected %s to match port %d %q: %t, got %t", test.spec, test.number, test.name, test.match,
+				match)
+		}
+	}
+}
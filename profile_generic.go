@@ -0,0 +1,91 @@
+package main
+
+import "gitlab.com/gomidi/midi/mid"
+
+// xTouchMini is the Behringer X-Touch Mini in standard mode, layer A. It has no displays and its fader is not
+// motorized, but the LED rings of the encoders follow the control changes sent to them.
+type xTouchMini struct{}
+
+func (p *xTouchMini) Name() string {
+	return "x-touch-mini"
+}
+
+func (p *xTouchMini) DefaultPort() string {
+	return "prefix:X-TOUCH MINI"
+}
+
+func (p *xTouchMini) Reset(w *mid.Writer) error {
+	err := resetNoteLeds(w, 8, 23)
+	if err != nil {
+		return err
+	}
+
+	for cc := uint8(1); cc <= 8; cc++ {
+		err := w.ControlChange(cc, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *xTouchMini) SetNoteLed(w *mid.Writer, note uint8, on bool) error {
+	return w.NoteOn(note, ledVelocity(on))
+}
+
+func (p *xTouchMini) SetControlLed(w *mid.Writer, controller uint8, on bool) error {
+	return nil
+}
+
+func (p *xTouchMini) SetLedRing(w *mid.Writer, controller uint8, value uint8) error {
+	return w.ControlChange(controller, value)
+}
+
+// nanoKontrol2 is the Korg nanoKONTROL2 in CC mode. Its buttons send control changes and only light up when the LED
+// mode is set to external with the Korg Kontrol Editor.
+type nanoKontrol2 struct{}
+
+var nanoKontrol2Buttons = []uint8{41, 42, 43, 44, 45, 46, 58, 59, 60, 61, 62}
+
+func (p *nanoKontrol2) Name() string {
+	return "nanokontrol2"
+}
+
+func (p *nanoKontrol2) DefaultPort() string {
+	return "prefix:nanoKONTROL2"
+}
+
+func (p *nanoKontrol2) Reset(w *mid.Writer) error {
+	for _, cc := range nanoKontrol2Buttons {
+		err := w.ControlChange(cc, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *nanoKontrol2) SetNoteLed(w *mid.Writer, note uint8, on bool) error {
+	return nil
+}
+
+func (p *nanoKontrol2) SetControlLed(w *mid.Writer, controller uint8, on bool) error {
+	return w.ControlChange(controller, ledVelocity(on))
+}
+
+// lpd8 is the Akai LPD8 on program 1. It only has inputs.
+type lpd8 struct{}
+
+func (p *lpd8) Name() string {
+	return "lpd8"
+}
+
+func (p *lpd8) DefaultPort() string {
+	return "prefix:LPD8"
+}
+
+func (p *lpd8) Reset(w *mid.Writer) error {
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mozillazg/go-unidecode"
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/mid"
+	"log"
+)
+
+const (
+	xTouchOneCcFader    uint8 = 70
+	xTouchOneCcLedRing  uint8 = 80
+	xTouchOneCcLedMeter uint8 = 90
+)
+
+const (
+	xTouchOneModeAuto     = "auto"
+	xTouchOneModeStandard = "standard"
+	xTouchOneModeMcu      = "mcu"
+)
+
+var xTouchOneSysExHeader = []byte{0x00, 0x20, 0x32, 0x41}
+
+// xTouchOne is the Behringer X-Touch One, either in standard MIDI mode or in Mackie Control Universal (MCU) mode. In
+// auto mode the protocol is detected from the first messages of the device.
+type xTouchOne struct {
+	mode     string
+	mcu      bool
+	detected bool
+	vPot     uint8
+}
+
+func (p *xTouchOne) Name() string {
+	return "x-touch-one"
+}
+
+func (p *xTouchOne) DefaultPort() string {
+	return "prefix:X-Touch One"
+}
+
+func (p *xTouchOne) SetMode(mode string) error {
+	switch mode {
+	case xTouchOneModeAuto, xTouchOneModeStandard:
+		p.mcu = false
+	case xTouchOneModeMcu:
+		p.mcu = true
+	default:
+		return fmt.Errorf("unknown mode %q, expected auto, standard or mcu", mode)
+	}
+
+	p.mode = mode
+	p.detected = false
+
+	return nil
+}
+
+func (p *xTouchOne) DetectMode(msg midi.Message) bool {
+	if p.mode != xTouchOneModeAuto || p.detected {
+		return false
+	}
+
+	mcu, known := detectMcu(msg)
+	if !known {
+		return false
+	}
+
+	p.detected = true
+	if mcu == p.mcu {
+		return false
+	}
+
+	p.mcu = mcu
+	if mcu {
+		log.Printf("detected X-Touch One in MCU mode")
+	} else {
+		log.Printf("detected X-Touch One in standard mode")
+	}
+
+	return true
+}
+
+func (p *xTouchOne) ResetDetection() {
+	p.detected = false
+}
+
+func (p *xTouchOne) TranslateInput(msg midi.Message) midi.Message {
+	if p.mcu {
+		return p.mcuTranslateInput(msg)
+	}
+
+	return msg
+}
+
+func (p *xTouchOne) Reset(w *mid.Writer) error {
+	if p.mcu {
+		return p.mcuReset(w)
+	}
+
+	err := resetNoteLeds(w, 1, 35)
+	if err != nil {
+		return err
+	}
+
+	err = w.ControlChange(xTouchOneCcFader, 0)
+	if err != nil {
+		return err
+	}
+
+	err = w.ControlChange(xTouchOneCcLedRing, 64)
+	if err != nil {
+		return err
+	}
+
+	err = w.ControlChange(xTouchOneCcLedMeter, 0)
+	if err != nil {
+		return err
+	}
+
+	err = w.SysEx(p.createSegmentDisplayData(EmptySegmentDisplayData()))
+	if err != nil {
+		return err
+	}
+
+	err = w.SysEx(p.createLcdDisplayData("", ColorBlack, InvertNone))
+	if err != nil {
+		return err
+	}
+
+	if p.mode == xTouchOneModeAuto && !p.detected {
+		// a device in MCU mode answers the device query, which makes it detectable before any button is pressed
+		return w.SysEx(append(append([]byte{}, mcuSysExHeader...), mcuDeviceQuery))
+	}
+
+	return nil
+}
+
+func (p *xTouchOne) SetNoteLed(w *mid.Writer, note uint8, on bool) error {
+	if p.mcu {
+		return p.mcuSetNoteLed(w, note, on)
+	}
+
+	return w.NoteOn(note, ledVelocity(on))
+}
+
+func (p *xTouchOne) SetControlLed(w *mid.Writer, controller uint8, on bool) error {
+	return nil
+}
+
+func (p *xTouchOne) SetFader(w *mid.Writer, controller uint8, value uint8) error {
+	if p.mcu {
+		return p.mcuSetFader(w, value)
+	}
+
+	return w.ControlChange(controller, value)
+}
+
+func (p *xTouchOne) SetLedRing(w *mid.Writer, controller uint8, value uint8) error {
+	if p.mcu {
+		return p.mcuSetLedRing(w, value)
+	}
+
+	return w.ControlChange(controller, value)
+}
+
+func (p *xTouchOne) SetLedMeter(w *mid.Writer, value uint8) error {
+	if p.mcu {
+		return p.mcuSetLedMeter(w, value)
+	}
+
+	return w.ControlChange(xTouchOneCcLedMeter, value)
+}
+
+func (p *xTouchOne) TextSize() (int, int) {
+	return 7, 2
+}
+
+func (p *xTouchOne) ShowText(w *mid.Writer, text string, color uint8, invert uint8) error {
+	if p.mcu {
+		return p.mcuShowText(w, text, color)
+	}
+
+	return w.SysEx(p.createLcdDisplayData(text, color, invert))
+}
+
+func (p *xTouchOne) SegmentDigits() int {
+	return 12
+}
+
+func (p *xTouchOne) ShowSegments(w *mid.Writer, data SegmentDisplayData) error {
+	if p.mcu {
+		return p.mcuShowSegments(w, data)
+	}
+
+	return w.SysEx(p.createSegmentDisplayData(data))
+}
+
+func (p *xTouchOne) createLcdDisplayData(characters string, color uint8, invert uint8) []byte {
+	text := make([]byte, 14)
+	copy(text, unidecode.Unidecode(characters))
+
+	colorCode := color | (invert << 4)
+
+	data := append([]byte{}, xTouchOneSysExHeader...)
+	data = append(data, 0x4c, 0x00, colorCode)
+
+	return append(data, text...)
+}
+
+func (p *xTouchOne) createSegmentDisplayData(segments SegmentDisplayData) []byte {
+	data := append([]byte{}, xTouchOneSysExHeader...)
+	data = append(data, 0x37)
+	data = append(data, segments.text...)
+
+	return append(data, segments.dots...)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"github.com/mozillazg/go-unidecode"
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/mid"
+	"gitlab.com/gomidi/midi/midimessage/channel"
+	"gitlab.com/gomidi/midi/midimessage/sysex"
+)
+
+const (
+	mcuCcVPot        uint8 = 16
+	mcuCcVPotLedRing uint8 = 48
+	mcuCcTimecode    uint8 = 64
+	mcuCcAssignment  uint8 = 74
+	mcuDeviceQuery   byte  = 0x00
+	mcuLcdCommand    byte  = 0x12
+	mcuColorsCommand byte  = 0x72
+	mcuLcdRowLength        = 56
+	mcuMeterMax            = 12
+)
+
+var mcuSysExHeader = []byte{0x00, 0x00, 0x66, 0x14}
+
+// xTouchOneMcuNotes maps the buttons of the X-Touch One in MCU mode to the notes it sends in standard mode, so the
+// same bindings work in both modes
+var xTouchOneMcuNotes = map[uint8]uint8{
+	32:  0,   // V-Pot 1 push: encoder
+	113: 1,   // SMPTE/Beats: time
+	91:  20,  // rewind: previous
+	92:  21,  // fast forward: next
+	93:  22,  // stop
+	94:  23,  // play
+	95:  24,  // record
+	46:  25,  // bank left
+	47:  26,  // bank right
+	104: 110, // fader 1 touch
+}
+
+var xTouchOneStandardNotes = func() map[uint8]uint8 {
+	notes := make(map[uint8]uint8, len(xTouchOneMcuNotes))
+	for mcu, standard := range xTouchOneMcuNotes {
+		notes[standard] = mcu
+	}
+
+	return notes
+}()
+
+// detectMcu tells from a message of the X-Touch One whether it is in MCU mode. known is false when the message may be
+// sent in both modes, which includes all buttons: the notes of MCU mode overlap with the notes of standard mode.
+func detectMcu(msg midi.Message) (mcu bool, known bool) {
+	switch m := msg.(type) {
+	case channel.Pitchbend:
+		return true, true
+	case sysex.SysEx:
+		if bytes.HasPrefix(m.Data(), mcuSysExHeader) {
+			return true, true
+		}
+	case channel.ControlChange:
+		switch m.Controller() {
+		case mcuCcVPot:
+			return true, true
+		case xTouchOneCcFader, xTouchOneCcLedRing:
+			return false, true
+		}
+	}
+
+	return false, false
+}
+
+func (p *xTouchOne) mcuTranslateInput(msg midi.Message) midi.Message {
+	switch m := msg.(type) {
+	case channel.NoteOn:
+		if key, ok := xTouchOneMcuNotes[m.Key()]; ok {
+			return channel.Channel0.NoteOn(key, m.Velocity())
+		}
+	case channel.NoteOff:
+		if key, ok := xTouchOneMcuNotes[m.Key()]; ok {
+			return channel.Channel0.NoteOff(key)
+		}
+	case channel.Pitchbend:
+		if m.Channel() == 0 {
+			return channel.Channel0.ControlChange(xTouchOneCcFader, uint8(m.AbsValue()>>7))
+		}
+	case channel.ControlChange:
+		if m.Controller() == mcuCcVPot {
+			// the V-Pot is relative: bit 6 is the direction, the lower bits the number of steps
+			delta := int(m.Value() & 0x3f)
+			if m.Value()&0x40 != 0 {
+				delta = -delta
+			}
+			p.vPot = clampMidiValue(int(p.vPot) + delta)
+
+			return channel.Channel0.ControlChange(xTouchOneCcLedRing, p.vPot)
+		}
+	}
+
+	return nil
+}
+
+func (p *xTouchOne) mcuReset(w *mid.Writer) error {
+	for _, note := range xTouchOneMcuNotes {
+		err := w.NoteOn(note, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := p.mcuSetFader(w, 0)
+	if err != nil {
+		return err
+	}
+
+	err = p.mcuSetLedRing(w, 64)
+	if err != nil {
+		return err
+	}
+
+	err = p.mcuSetLedMeter(w, 0)
+	if err != nil {
+		return err
+	}
+
+	err = p.mcuShowSegments(w, EmptySegmentDisplayData())
+	if err != nil {
+		return err
+	}
+
+	return p.mcuShowText(w, "", ColorBlack)
+}
+
+func (p *xTouchOne) mcuSetNoteLed(w *mid.Writer, note uint8, on bool) error {
+	if key, ok := xTouchOneStandardNotes[note]; ok {
+		return w.NoteOn(key, ledVelocity(on))
+	}
+
+	return nil
+}
+
+func (p *xTouchOne) mcuSetFader(w *mid.Writer, value uint8) error {
+	return w.Pitchbend(int16(int(value)*16383/127 - 8192))
+}
+
+func (p *xTouchOne) mcuSetLedRing(w *mid.Writer, value uint8) error {
+	p.vPot = value
+
+	// single dot mode, positions 1 to 11
+	return w.ControlChange(mcuCcVPotLedRing, uint8(1+int(value)*10/127))
+}
+
+func (p *xTouchOne) mcuSetLedMeter(w *mid.Writer, value uint8) error {
+	return w.Aftertouch(uint8(int(value) * mcuMeterMax / 127))
+}
+
+func (p *xTouchOne) mcuShowText(w *mid.Writer, text string, color uint8) error {
+	characters := []byte(unidecode.Unidecode(text))
+	rows := [][]byte{make([]byte, 7), make([]byte, 7)}
+	for i, row := range rows {
+		for j := range row {
+			row[j] = ' '
+			if k := i*7 + j; k < len(characters) && characters[k] != 0 {
+				row[j] = characters[k]
+			}
+		}
+	}
+
+	for i, row := range rows {
+		data := append([]byte{}, mcuSysExHeader...)
+		data = append(data, mcuLcdCommand, byte(i*mcuLcdRowLength))
+		err := w.SysEx(append(data, row...))
+		if err != nil {
+			return err
+		}
+	}
+
+	colors := append([]byte{}, mcuSysExHeader...)
+	colors = append(colors, mcuColorsCommand)
+
+	return w.SysEx(append(colors, color, 0, 0, 0, 0, 0, 0, 0))
+}
+
+// mcuShowSegments writes the 12 digits as the 2 assignment digits followed by the 10 timecode digits, which are
+// addressed from right to left
+func (p *xTouchOne) mcuShowSegments(w *mid.Writer, segments SegmentDisplayData) error {
+	for i, c := range segments.chars {
+		value := mcuSegmentCharacter(c)
+		if segments.dots[i/7]&(1<<(i%7)) != 0 {
+			value |= 0x40
+		}
+
+		var controller uint8
+		if i < 2 {
+			controller = mcuCcAssignment + 1 - uint8(i)
+		} else {
+			controller = mcuCcTimecode + 9 - uint8(i-2)
+		}
+
+		err := w.ControlChange(controller, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mcuSegmentCharacter(c byte) uint8 {
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+
+	switch {
+	case c >= 0x40 && c <= 0x5f:
+		return c - 0x40
+	case c >= 0x20 && c <= 0x3f:
+		return c
+	}
+
+	return ' '
+}
+
+func clampMidiValue(value int) uint8 {
+	if value < 0 {
+		return 0
+	}
+	if value > 127 {
+		return 127
+	}
+
+	return uint8(value)
+}
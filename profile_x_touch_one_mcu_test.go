@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/midimessage/channel"
+	"gitlab.com/gomidi/midi/midireader"
+	"reflect"
+	"testing"
+)
+
+// readMidiMessage parses a raw message like it is received from the device
+func readMidiMessage(t *testing.T, data []byte) midi.Message {
+	msg, err := midireader.New(bytes.NewReader(data), nil).Read()
+	if err != nil {
+		t.Fatalf("error while reading message % X: %v", data, err)
+	}
+
+	return msg
+}
+
+func TestDetectMcu(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		mcu   bool
+		known bool
+	}{
+		{name: "fader in mcu mode", data: []byte{0xE0, 0x00, 0x40}, mcu: true, known: true},
+		{name: "device query answer", data: []byte{0xF0, 0x00, 0x00, 0x66, 0x14, 0x01, 0xF7}, mcu: true, known: true},
+		{name: "other sysex", data: []byte{0xF0, 0x00, 0x20, 0x32, 0x41, 0x01, 0xF7}},
+		{name: "v-pot in mcu mode", data: []byte{0xB0, mcuCcVPot, 0x01}, mcu: true, known: true},
+		{name: "fader in standard mode", data: []byte{0xB0, xTouchOneCcFader, 100}, known: true},
+		{name: "encoder in standard mode", data: []byte{0xB0, xTouchOneCcLedRing, 65}, known: true},
+		{name: "other control", data: []byte{0xB0, 7, 100}},
+		{name: "play in mcu mode", data: []byte{0x90, 94, 127}},
+		{name: "button in standard mode", data: []byte{0x90, 20, 127}},
+		{name: "button release", data: []byte{0x80, 104, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mcu, known := detectMcu(readMidiMessage(t, test.data))
+			if mcu != test.mcu || known != test.known {
+				t.Errorf("expected mcu %t known %t, got mcu %t known %t", test.mcu, test.known, mcu, known)
+			}
+		})
+	}
+}
+
+func TestXTouchOneDetectMode(t *testing.T) {
+	p := &xTouchOne{mode: xTouchOneModeAuto}
+
+	if p.DetectMode(readMidiMessage(t, []byte{0x90, 94, 127})) || p.mcu {
+		t.Error("expected a button not to be detected")
+	}
+	if !p.DetectMode(readMidiMessage(t, []byte{0xE0, 0x00, 0x40})) || !p.mcu {
+		t.Error("expected the fader to switch to mcu mode")
+	}
+	if p.DetectMode(readMidiMessage(t, []byte{0xB0, xTouchOneCcFader, 100})) || !p.mcu {
+		t.Error("expected the detection to be finished")
+	}
+
+	p.ResetDetection()
+	if !p.DetectMode(readMidiMessage(t, []byte{0xB0, xTouchOneCcFader, 100})) || p.mcu {
+		t.Error("expected the fader to switch back to standard mode after a new detection")
+	}
+
+	p = &xTouchOne{mode: xTouchOneModeStandard}
+	if p.DetectMode(readMidiMessage(t, []byte{0xE0, 0x00, 0x40})) || p.mcu {
+		t.Error("expected no detection in standard mode")
+	}
+}
+
+func TestXTouchOneMcuTranslateInput(t *testing.T) {
+	tests := []struct {
+		name string
+		vPot uint8
+		data []byte
+		// translated is the translated message, or nil when the message is ignored
+		translated midi.Message
+	}{
+		{name: "play", data: []byte{0x90, 94, 127}, translated: channel.Channel0.NoteOn(23, 127)},
+		{name: "encoder push", data: []byte{0x90, 32, 127}, translated: channel.Channel0.NoteOn(0, 127)},
+		{name: "fader touch", data: []byte{0x90, 104, 127}, translated: channel.Channel0.NoteOn(110, 127)},
+		{name: "fader release", data: []byte{0x80, 104, 0}, translated: channel.Channel0.NoteOff(110)},
+		{name: "fader release as note on", data: []byte{0x90, 104, 0}, translated: channel.Channel0.NoteOff(110)},
+		{name: "unmapped button", data: []byte{0x90, 50, 127}},
+		{name: "fader bottom", data: []byte{0xE0, 0x00, 0x00},
+			translated: channel.Channel0.ControlChange(xTouchOneCcFader, 0)},
+		{name: "fader center", data: []byte{0xE0, 0x00, 0x40},
+			translated: channel.Channel0.ControlChange(xTouchOneCcFader, 64)},
+		{name: "fader top", data: []byte{0xE0, 0x7F, 0x7F},
+			translated: channel.Channel0.ControlChange(xTouchOneCcFader, 127)},
+		{name: "pitchbend of another channel", data: []byte{0xE1, 0x7F, 0x7F}},
+		{name: "v-pot right", vPot: 64, data: []byte{0xB0, mcuCcVPot, 0x03},
+			translated: channel.Channel0.ControlChange(xTouchOneCcLedRing, 67)},
+		{name: "v-pot left", vPot: 64, data: []byte{0xB0, mcuCcVPot, 0x42},
+			translated: channel.Channel0.ControlChange(xTouchOneCcLedRing, 62)},
+		{name: "v-pot below the bottom", vPot: 10, data: []byte{0xB0, mcuCcVPot, 0x7F},
+			translated: channel.Channel0.ControlChange(xTouchOneCcLedRing, 0)},
+		{name: "v-pot above the top", vPot: 120, data: []byte{0xB0, mcuCcVPot, 0x3F},
+			translated: channel.Channel0.ControlChange(xTouchOneCcLedRing, 127)},
+		{name: "other control", data: []byte{0xB0, 7, 100}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &xTouchOne{mode: xTouchOneModeMcu, mcu: true, vPot: test.vPot}
+
+			translated := p.TranslateInput(readMidiMessage(t, test.data))
+			if test.translated == nil {
+				if translated != nil {
+					t.Errorf("expected the message to be ignored, got %v", translated)
+				}
+				return
+			}
+			if !reflect.DeepEqual(translated, test.translated) {
+				t.Errorf("expected %v, got %v", test.translated, translated)
+			}
+		})
+	}
+}
+
+func TestXTouchOneMcuResetError(t *testing.T) {
+	testResetErrors(t, &xTouchOne{mode: xTouchOneModeMcu, mcu: true})
+}
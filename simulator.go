@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"gitlab.com/gomidi/midi/mid"
+	"golang.org/x/term"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Simulator emulates an X-Touch One in standard mode in the terminal, so the event handler can be developed without
+// the hardware. It renders the LCD, segment display, button LEDs, fader, LED ring and meter, and turns key presses
+// into the messages of the device.
+type Simulator struct {
+	driver *virtualDriver
+
+	mutex         sync.Mutex
+	runningStatus byte
+	lcdText       []byte
+	lcdColor      uint8
+	lcdInvert     uint8
+	segments      []byte
+	dots          []byte
+	leds          map[uint8]bool
+	fader         uint8
+	ledRing       uint8
+	ledMeter      uint8
+	logLines      []string
+
+	terminalState *term.State
+	done          chan struct{}
+}
+
+type simulatorButton struct {
+	key   string
+	label string
+	note  uint8
+}
+
+var simulatorButtons = []simulatorButton{
+	{"1", "TIME", 1},
+	{"enter", "ENCODER", 0},
+	{",", "<<", 20},
+	{".", ">>", 21},
+	{"s", "STOP", 22},
+	{"space", "PLAY", 23},
+	{"r", "REC", 24},
+	{"[", "BANK<", 25},
+	{"]", "BANK>", 26},
+}
+
+const (
+	simulatorNoteFaderTouch uint8 = 110
+	simulatorFaderStep            = 8
+	simulatorLogLines             = 5
+)
+
+// ANSI foreground colors for the LCD colors
+var simulatorColors = map[uint8]int{
+	ColorBlack:   90,
+	ColorRed:     31,
+	ColorGreen:   32,
+	ColorYellow:  33,
+	ColorBlue:    34,
+	ColorMagenta: 35,
+	ColorCyan:    36,
+	ColorWhite:   37,
+}
+
+func NewSimulator() *Simulator {
+	s := &Simulator{
+		lcdText:  make([]byte, 14),
+		segments: make([]byte, 12),
+		dots:     make([]byte, 2),
+		leds:     make(map[uint8]bool),
+		done:     make(chan struct{}),
+	}
+	s.driver = newVirtualDriver(s)
+
+	return s
+}
+
+func (s *Simulator) Driver() mid.Driver {
+	return s.driver
+}
+
+// Done is closed when the user quits the simulator
+func (s *Simulator) Done() <-chan struct{} {
+	return s.done
+}
+
+// Start switches the terminal to raw mode, captures the log and starts reading the keyboard
+func (s *Simulator) Start() error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	s.terminalState = state
+
+	log.SetOutput(s)
+	fmt.Print("\x1b[?25l")
+	s.render()
+
+	go s.readKeys(os.Stdin)
+
+	return nil
+}
+
+func (s *Simulator) Stop() {
+	log.SetOutput(os.Stderr)
+	fmt.Print("\x1b[?25h\r\n")
+
+	if s.terminalState != nil {
+		term.Restore(int(os.Stdin.Fd()), s.terminalState)
+	}
+}
+
+// Write receives the log output, of which the last lines are shown below the controller
+func (s *Simulator) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		s.logLines = append(s.logLines, line)
+	}
+	if len(s.logLines) > simulatorLogLines {
+		s.logLines = s.logLines[len(s.logLines)-simulatorLogLines:]
+	}
+	s.mutex.Unlock()
+
+	s.render()
+
+	return len(p), nil
+}
+
+// handleOutput decodes the messages sent to the device, which may use running status
+func (s *Simulator) handleOutput(data []byte) {
+	s.mutex.Lock()
+
+	for len(data) > 0 {
+		status := data[0]
+		if status >= 0x80 {
+			data = data[1:]
+		} else {
+			status = s.runningStatus
+		}
+
+		if status == 0xf0 {
+			end := bytes.IndexByte(data, 0xf7)
+			if end == -1 {
+				end = len(data)
+			}
+			s.handleSysEx(data[:end])
+			if end < len(data) {
+				end++
+			}
+			data = data[end:]
+			continue
+		}
+
+		s.runningStatus = status
+		if len(data) < 2 {
+			break
+		}
+
+		switch status & 0xf0 {
+		case 0x90:
+			s.leds[data[0]] = data[1] > 0
+		case 0x80:
+			s.leds[data[0]] = false
+		case 0xb0:
+			s.handleControlChange(data[0], data[1])
+		}
+		data = data[2:]
+	}
+
+	s.mutex.Unlock()
+
+	s.render()
+}
+
+func (s *Simulator) handleControlChange(controller uint8, value uint8) {
+	switch controller {
+	case xTouchOneCcFader:
+		s.fader = value
+	case xTouchOneCcLedRing:
+		s.ledRing = value
+	case xTouchOneCcLedMeter:
+		s.ledMeter = value
+	}
+}
+
+func (s *Simulator) handleSysEx(data []byte) {
+	if !bytes.HasPrefix(data, xTouchOneSysExHeader) || len(data) < len(xTouchOneSysExHeader)+1 {
+		return
+	}
+
+	data = data[len(xTouchOneSysExHeader):]
+	switch {
+	case data[0] == 0x4c && len(data) >= 3:
+		s.lcdColor = data[2] & 0x0f
+		s.lcdInvert = data[2] >> 4
+		copy(s.lcdText, data[3:])
+	case data[0] == 0x37:
+		copy(s.segments, data[1:])
+		if len(data) > 13 {
+			copy(s.dots, data[13:])
+		}
+	}
+}
+
+func (s *Simulator) readKeys(r io.Reader) {
+	buffer := make([]byte, 16)
+	for {
+		n, err := r.Read(buffer)
+		if err != nil {
+			close(s.done)
+			return
+		}
+
+		key := string(buffer[:n])
+		switch key {
+		case "q", "\x03":
+			close(s.done)
+			return
+		case "\x1b[D":
+			s.turnEncoder(-1)
+		case "\x1b[C":
+			s.turnEncoder(+1)
+		case "\x1b[A":
+			s.moveFader(+simulatorFaderStep)
+		case "\x1b[B":
+			s.moveFader(-simulatorFaderStep)
+		case " ":
+			s.pressButton("space")
+		case "\r":
+			s.pressButton("enter")
+		default:
+			s.pressButton(key)
+		}
+	}
+}
+
+func (s *Simulator) pressButton(key string) {
+	for _, button := range simulatorButtons {
+		if button.key == key {
+			s.driver.in.send([]byte{0x90, button.note, 127})
+			s.driver.in.send([]byte{0x90, button.note, 0})
+		}
+	}
+}
+
+// turnEncoder changes the value of the encoder relative to the last value of the LED ring, as the encoder of the
+// device does in standard mode
+func (s *Simulator) turnEncoder(delta int) {
+	s.mutex.Lock()
+	s.ledRing = clampMidiValue(int(s.ledRing) + delta)
+	value := s.ledRing
+	s.mutex.Unlock()
+
+	s.driver.in.send([]byte{0xb0, xTouchOneCcLedRing, value})
+	s.render()
+}
+
+func (s *Simulator) moveFader(delta int) {
+	s.mutex.Lock()
+	s.fader = clampMidiValue(int(s.fader) + delta)
+	value := s.fader
+	s.mutex.Unlock()
+
+	s.driver.in.send([]byte{0x90, simulatorNoteFaderTouch, 127})
+	s.driver.in.send([]byte{0xb0, xTouchOneCcFader, value})
+	s.driver.in.send([]byte{0x90, simulatorNoteFaderTouch, 0})
+	s.render()
+}
+
+func (s *Simulator) render() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.terminalState == nil {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	b.WriteString("X-Touch One simulator (q to quit)\r\n\r\n")
+
+	for _, line := range renderSegments(s.segments, s.dots) {
+		b.WriteString("  " + line + "\r\n")
+	}
+	b.WriteString("\r\n")
+
+	color := simulatorColors[s.lcdColor]
+	for row := 0; row < 2; row++ {
+		text := strings.Map(func(r rune) rune {
+			if r == 0 {
+				return ' '
+			}
+			return r
+		}, string(s.lcdText[row*7:row*7+7]))
+
+		if s.lcdInvert&(1<<row) != 0 {
+			fmt.Fprintf(&b, "  \x1b[30;%dm %s \x1b[0m\r\n", color+10, text)
+		} else {
+			fmt.Fprintf(&b, "  \x1b[%d;40m %s \x1b[0m\r\n", color, text)
+		}
+	}
+	b.WriteString("\r\n")
+
+	b.WriteString("  ")
+	for _, button := range simulatorButtons {
+		if s.leds[button.note] {
+			fmt.Fprintf(&b, "\x1b[7m[%s]\x1b[0m ", button.label)
+		} else {
+			fmt.Fprintf(&b, "[%s] ", button.label)
+		}
+	}
+	b.WriteString("\r\n\r\n")
+
+	fmt.Fprintf(&b, "  Fader %s %3d\r\n", renderBar(s.fader, 26), s.fader)
+	fmt.Fprintf(&b, "  Ring  %s %3d\r\n", renderRing(s.ledRing, 13), s.ledRing)
+	fmt.Fprintf(&b, "  Meter %s %3d\r\n", renderBar(s.ledMeter, 26), s.ledMeter)
+	b.WriteString("\r\n")
+
+	b.WriteString("  Keys: ")
+	for _, button := range simulatorButtons {
+		fmt.Fprintf(&b, "%s=%s ", button.key, button.label)
+	}
+	b.WriteString("\r\n        left/right=encoder up/down=fader\r\n\r\n")
+
+	for _, line := range s.logLines {
+		b.WriteString(line + "\r\n")
+	}
+
+	os.Stdout.WriteString(b.String())
+}
+
+// renderSegments draws the 7-segment digits rendered by lcd7bitRender on three lines
+func renderSegments(segments []byte, dots []byte) []string {
+	lines := make([]string, 3)
+	for i, segment := range segments {
+		lines[0] += " " + segmentChar(segment, 0, '_') + "  "
+		lines[1] += segmentChar(segment, 5, '|') + segmentChar(segment, 6, '_') + segmentChar(segment, 1, '|') + " "
+
+		dot := " "
+		if dots[i/7]&(1<<(i%7)) != 0 {
+			dot = "."
+		}
+		lines[2] += segmentChar(segment, 4, '|') + segmentChar(segment, 3, '_') + segmentChar(segment, 2, '|') + dot
+	}
+
+	return lines
+}
+
+func segmentChar(segment byte, bit uint, c byte) string {
+	if segment&(1<<bit) != 0 {
+		return string(c)
+	}
+
+	return " "
+}
+
+func renderBar(value uint8, width int) string {
+	filled := int(value) * width / 127
+
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+func renderRing(value uint8, leds int) string {
+	position := int(value) * (leds - 1) / 127
+
+	return "[" + strings.Repeat("-", position) + "o" + strings.Repeat("-", leds-position-1) + "]"
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"gitlab.com/gomidi/midi/mid"
+	"sync"
+)
+
+const simulatorPortName = "X-Touch One Simulator"
+
+// virtualDriver is a mid.Driver with a single input and output port, which are connected to a Simulator instead of
+// a MIDI device
+type virtualDriver struct {
+	in  *virtualIn
+	out *virtualOut
+}
+
+func newVirtualDriver(simulator *Simulator) *virtualDriver {
+	return &virtualDriver{
+		in:  &virtualIn{virtualPort: virtualPort{name: simulatorPortName}},
+		out: &virtualOut{virtualPort: virtualPort{name: simulatorPortName}, simulator: simulator},
+	}
+}
+
+func (d *virtualDriver) Ins() ([]mid.In, error) {
+	return []mid.In{d.in}, nil
+}
+
+func (d *virtualDriver) Outs() ([]mid.Out, error) {
+	return []mid.Out{d.out}, nil
+}
+
+func (d *virtualDriver) String() string {
+	return "virtual"
+}
+
+func (d *virtualDriver) Close() error {
+	d.in.Close()
+	d.out.Close()
+
+	return nil
+}
+
+type virtualPort struct {
+	name   string
+	isOpen bool
+	mutex  sync.Mutex
+}
+
+func (p *virtualPort) Open() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.isOpen = true
+
+	return nil
+}
+
+func (p *virtualPort) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.isOpen = false
+
+	return nil
+}
+
+func (p *virtualPort) IsOpen() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.isOpen
+}
+
+func (p *virtualPort) Number() int {
+	return 0
+}
+
+func (p *virtualPort) String() string {
+	return p.name
+}
+
+func (p *virtualPort) Underlying() interface{} {
+	return nil
+}
+
+type virtualIn struct {
+	virtualPort
+	listener func(data []byte, deltaMicroseconds int64)
+}
+
+func (p *virtualIn) SetListener(listener func(data []byte, deltaMicroseconds int64)) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.listener = listener
+
+	return nil
+}
+
+func (p *virtualIn) StopListening() error {
+	return p.SetListener(nil)
+}
+
+func (p *virtualIn) Close() error {
+	p.StopListening()
+
+	return p.virtualPort.Close()
+}
+
+// send delivers a message from the simulated device to the listener of the port
+func (p *virtualIn) send(data []byte) {
+	p.mutex.Lock()
+	listener := p.listener
+	isOpen := p.isOpen
+	p.mutex.Unlock()
+
+	if isOpen && listener != nil {
+		listener(data, 0)
+	}
+}
+
+type virtualOut struct {
+	virtualPort
+	simulator *Simulator
+}
+
+func (p *virtualOut) Send(data []byte) error {
+	if !p.IsOpen() {
+		return mid.ErrClosed
+	}
+
+	p.simulator.handleOutput(data)
+
+	return nil
+}
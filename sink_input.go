@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pulseVolumeNorm is the volume of 100% in PulseAudio
+const pulseVolumeNorm = 0x10000
+
+// SinkInput is a playback stream of an application. The mafik/pulseaudio client does not expose streams, so they are
+// listed and changed with pactl.
+type SinkInput struct {
+	Index           int
+	Sink            int
+	ProcessID       int
+	ApplicationName string
+	ProcessBinary   string
+	Volume          float32
+}
+
+type pactlSinkInput struct {
+	Index      int                           `json:"index"`
+	Sink       int                           `json:"sink"`
+	Properties map[string]string             `json:"properties"`
+	Volume     map[string]pactlVolumeChannel `json:"volume"`
+}
+
+type pactlVolumeChannel struct {
+	Value int `json:"value"`
+}
+
+func ListSinkInputs() ([]SinkInput, error) {
+	output, err := pactl("-f", "json", "list", "sink-inputs")
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []pactlSinkInput
+	err = json.Unmarshal(output, &inputs)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading sink inputs: %v", err)
+	}
+
+	sinkInputs := make([]SinkInput, len(inputs))
+	for i, input := range inputs {
+		pid, _ := strconv.Atoi(input.Properties["application.process.id"])
+
+		volume := 0
+		for _, channel := range input.Volume {
+			if channel.Value > volume {
+				volume = channel.Value
+			}
+		}
+
+		sinkInputs[i] = SinkInput{
+			Index:           input.Index,
+			Sink:            input.Sink,
+			ProcessID:       pid,
+			ApplicationName: input.Properties["application.name"],
+			ProcessBinary:   input.Properties["application.process.binary"],
+			Volume:          float32(volume) / pulseVolumeNorm,
+		}
+	}
+
+	return sinkInputs, nil
+}
+
+func SetSinkInputVolume(index int, volume float32) error {
+	raw := strconv.Itoa(int(volume * pulseVolumeNorm))
+
+	_, err := pactl("set-sink-input-volume", strconv.Itoa(index), raw)
+
+	return err
+}
+
+// FindPlayerSinkInputs returns the streams of a player. A stream belongs to the player when it was created by the
+// process which owns the bus name of the player, or by one of its child processes (like the audio service of
+// Chrome). When the process is unknown, the streams are matched by application name. readStat reads the status of a
+// process like readProcStat.
+func FindPlayerSinkInputs(sinkInputs []SinkInput, pid int, name string, readStat func(pid int) ([]byte, error)) []SinkInput {
+	var found []SinkInput
+
+	if pid != 0 {
+		for _, input := range sinkInputs {
+			if isProcessDescendant(input.ProcessID, pid, readStat) {
+				found = append(found, input)
+			}
+		}
+
+		if len(found) != 0 {
+			return found
+		}
+	}
+
+	for _, input := range sinkInputs {
+		if strings.EqualFold(input.ApplicationName, name) || strings.EqualFold(input.ProcessBinary, name) {
+			found = append(found, input)
+		}
+	}
+
+	return found
+}
+
+// isProcessDescendant returns true when pid is ancestor or one of its descendants
+func isProcessDescendant(pid int, ancestor int, readStat func(pid int) ([]byte, error)) bool {
+	// the processes may have changed while walking up, which could lead into a loop
+	visited := make(map[int]bool)
+
+	for pid > 1 && !visited[pid] {
+		if pid == ancestor {
+			return true
+		}
+
+		visited[pid] = true
+		pid = parentProcessID(pid, readStat)
+	}
+
+	return false
+}
+
+// readProcStat reads the status of a process from /proc
+func readProcStat(pid int) ([]byte, error) {
+	return os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+}
+
+// parentProcessID returns the parent of a process, or 0 when its status cannot be read
+func parentProcessID(pid int, readStat func(pid int) ([]byte, error)) int {
+	data, err := readStat(pid)
+	if err != nil {
+		return 0
+	}
+
+	// the command name in the second field may contain spaces and parentheses, the fields after it do not
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 2 {
+		return 0
+	}
+
+	ppid, _ := strconv.Atoi(fields[1])
+
+	return ppid
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// fakeProcStat returns a reader of the status of the processes in parents, which maps them to their parent
+func fakeProcStat(parents map[int]int) func(pid int) ([]byte, error) {
+	return func(pid int) ([]byte, error) {
+		ppid, ok := parents[pid]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+
+		// the command name may contain spaces and parentheses
+		return []byte(fmt.Sprintf("%d (Web Content (%d)) S %d %d %d 0 -1 4194560", pid, pid, ppid, pid, pid)), nil
+	}
+}
+
+func TestFindPlayerSinkInputs(t *testing.T) {
+	parents := map[int]int{
+		100: 1,
+		// the audio service of the player
+		200: 100,
+		300: 200,
+		// another application
+		400: 1,
+		// processes of which the parents form a loop
+		500: 501,
+		501: 500,
+	}
+
+	tests := []struct {
+		name       string
+		sinkInputs []SinkInput
+		pid        int
+		player     string
+		indexes    []int
+	}{
+		{
+			name: "stream of the player process",
+			sinkInputs: []SinkInput{
+				{Index: 1, ProcessID: 100, ApplicationName: "Chromium"},
+				{Index: 2, ProcessID: 400, ApplicationName: "Firefox"},
+			},
+			pid:     100,
+			player:  "chromium",
+			indexes: []int{1},
+		},
+		{
+			name: "stream of a descendant of the player process",
+			sinkInputs: []SinkInput{
+				{Index: 1, ProcessID: 300, ApplicationName: "Chromium"},
+				{Index: 2, ProcessID: 400, ApplicationName: "Firefox"},
+				{Index: 3, ProcessID: 200, ApplicationName: "Chromium"},
+			},
+			pid:     100,
+			player:  "chromium",
+			indexes: []int{1, 3},
+		},
+		{
+			name: "streams by name are not used when a stream of the process was found",
+			sinkInputs: []SinkInput{
+				{Index: 1, ProcessID: 300, ApplicationName: "Chromium"},
+				{Index: 2, ProcessID: 400, ApplicationName: "Chromium"},
+			},
+			pid:     100,
+			player:  "chromium",
+			indexes: []int{1},
+		},
+		{
+			name: "fallback to the application name",
+			sinkInputs: []SinkInput{
+				{Index: 1, ProcessID: 400, ApplicationName: "Spotify"},
+				{Index: 2, ProcessID: 400, ApplicationName: "Firefox"},
+			},
+			pid:     100,
+			player:  "spotify",
+			indexes: []int{1},
+		},
+		{
+			name: "fallback to the process binary for an unknown process",
+			sinkInputs: []SinkInput{
+				{Index: 1, ProcessID: 400, ApplicationName: "Music", ProcessBinary: "rhythmbox"},
+				{Index: 2, ProcessID: 400, ApplicationName: "Firefox", ProcessBinary: "firefox"},
+			},
+			player:  "Rhythmbox",
+			indexes: []int{1},
+		},
+		{
+			name: "a loop of parents ends the walk",
+			sinkInputs: []SinkInput{
+				{Index: 1, ProcessID: 500, ApplicationName: "vlc"},
+			},
+			pid:     100,
+			player:  "vlc",
+			indexes: []int{1},
+		},
+		{
+			name: "a process which is gone ends the walk",
+			sinkInputs: []SinkInput{
+				{Index: 1, ProcessID: 600, ApplicationName: "Firefox"},
+				{Index: 2, ProcessID: 300, ApplicationName: "Chromium"},
+			},
+			pid:     100,
+			player:  "firefox",
+			indexes: []int{2},
+		},
+		{
+			name: "no stream",
+			sinkInputs: []SinkInput{
+				{Index: 1, ProcessID: 400, ApplicationName: "Firefox"},
+			},
+			pid:    100,
+			player: "chromium",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var indexes []int
+			for _, input := range FindPlayerSinkInputs(test.sinkInputs, test.pid, test.player, fakeProcStat(parents)) {
+				indexes = append(indexes, input.Index)
+			}
+
+			if !reflect.DeepEqual(indexes, test.indexes) {
+				t.Errorf("expected streams %v, got %v", test.indexes, indexes)
+			}
+		})
+	}
+}
+
+func TestParentProcessID(t *testing.T) {
+	stat := func(data string) func(pid int) ([]byte, error) {
+		return func(pid int) ([]byte, error) {
+			return []byte(data), nil
+		}
+	}
+
+	tests := []struct {
+		name     string
+		readStat func(pid int) ([]byte, error)
+		ppid     int
+	}{
+		{name: "plain command", readStat: stat("300 (chrome) S 200 300 300 0 -1"), ppid: 200},
+		{name: "command with spaces", readStat: stat("300 (Web Content) S 200 300 300 0 -1"), ppid: 200},
+		{name: "command with parentheses", readStat: stat("300 (a) S 1 (b)) S 200 300 300 0 -1"), ppid: 200},
+		{name: "truncated status", readStat: stat("300 (chrome) S"), ppid: 0},
+		{name: "missing process", readStat: fakeProcStat(nil), ppid: 0},
+	}
+
+	for _, test := range tests {
+		if ppid := parentProcessID(300, test.readStat); ppid != test.ppid {
+			t.Errorf("%s: expected parent %d, got %d", test.name, test.ppid, ppid)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
+import "time"
+
 type Track struct {
 	artist      string
 	albumArtist string
 	album       string
 	title       string
 	trackNumber int
+	length      time.Duration
 }
 
 func (t *Track) isDifferent(o *Track) bool {
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	volumeCurveLinear = "linear"
+	volumeCurveCubic  = "cubic"
+	volumeCurveDb     = "db"
+)
+
+// VolumeCurve maps the position of a fader to a PulseAudio volume and back, so the fader can be moved to the position
+// the volume was set from. PulseAudio volumes are already cubic in amplitude, so the cubic curve uses them as they are,
+// like pavucontrol. The linear curve is linear in amplitude and the dB curve spreads the range from the floor to 0 dB
+// evenly over the fader.
+type VolumeCurve struct {
+	curve   string
+	dbFloor float64
+}
+
+func NewVolumeCurve(config MixerConfig) (*VolumeCurve, error) {
+	switch config.Curve {
+	case volumeCurveLinear, volumeCurveCubic:
+	case volumeCurveDb:
+		if config.DbFloor >= 0 {
+			return nil, fmt.Errorf("db_floor must be negative")
+		}
+	default:
+		return nil, fmt.Errorf("unknown volume curve %q, expected linear, cubic or db", config.Curve)
+	}
+
+	return &VolumeCurve{curve: config.Curve, dbFloor: config.DbFloor}, nil
+}
+
+// Volume returns the volume for a fader value from 0 to 127
+func (c *VolumeCurve) Volume(value uint8) float32 {
+	position := float64(value) / 127
+
+	switch c.curve {
+	case volumeCurveLinear:
+		return float32(math.Cbrt(position))
+	case volumeCurveDb:
+		if value == 0 {
+			return 0
+		}
+		// PulseAudio volumes are cubic, so a volume v is 60 * log10(v) dB
+		return float32(math.Pow(10, c.dbFloor*(1-position)/60))
+	}
+
+	return float32(position)
+}
+
+// Value returns the fader value from 0 to 127 for a volume
+func (c *VolumeCurve) Value(volume float32) uint8 {
+	position := float64(volume)
+	if position <= 0 {
+		return 0
+	}
+
+	switch c.curve {
+	case volumeCurveLinear:
+		position = position * position * position
+	case volumeCurveDb:
+		position = 1 - 60*math.Log10(position)/c.dbFloor
+	}
+
+	return clampMidiValue(int(math.Round(position * 127)))
+}
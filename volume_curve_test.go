@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVolumeCurve(t *testing.T) {
+	tests := []struct {
+		curve   string
+		dbFloor float64
+		value   uint8
+		volume  float32
+	}{
+		{curve: volumeCurveCubic, value: 0, volume: 0},
+		{curve: volumeCurveCubic, value: 64, volume: 0.5039},
+		{curve: volumeCurveCubic, value: 127, volume: 1},
+		{curve: volumeCurveLinear, value: 0, volume: 0},
+		{curve: volumeCurveLinear, value: 64, volume: 0.7958},
+		{curve: volumeCurveLinear, value: 127, volume: 1},
+		{curve: volumeCurveDb, dbFloor: -60, value: 0, volume: 0},
+		{curve: volumeCurveDb, dbFloor: -60, value: 64, volume: 0.3191},
+		{curve: volumeCurveDb, dbFloor: -60, value: 127, volume: 1},
+		{curve: volumeCurveDb, dbFloor: -30, value: 0, volume: 0},
+		{curve: volumeCurveDb, dbFloor: -30, value: 64, volume: 0.5649},
+		{curve: volumeCurveDb, dbFloor: -30, value: 127, volume: 1},
+	}
+
+	for _, test := range tests {
+		c, err := NewVolumeCurve(MixerConfig{Curve: test.curve, DbFloor: test.dbFloor})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		volume := c.Volume(test.value)
+		if math.Abs(float64(volume-test.volume)) > 0.0001 {
+			t.Errorf("%s %v: expected volume %v for value %d, got %v", test.curve, test.dbFloor, test.volume,
+				test.value, volume)
+		}
+		// the motor fader is moved back to the value the volume was set from
+		if value := c.Value(volume); value != test.value {
+			t.Errorf("%s %v: expected value %d for volume %v, got %d", test.curve, test.dbFloor, test.value, volume,
+				value)
+		}
+	}
+}
+
+func TestNewVolumeCurveError(t *testing.T) {
+	configs := []MixerConfig{
+		{Curve: "logarithmic"},
+		{Curve: volumeCurveDb, DbFloor: 0},
+		{Curve: volumeCurveDb, DbFloor: 6},
+	}
+
+	for _, config := range configs {
+		if _, err := NewVolumeCurve(config); err == nil {
+			t.Errorf("expected an error for curve %q with floor %v", config.Curve, config.DbFloor)
+		}
+	}
+}
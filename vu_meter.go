@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"log"
+	"math"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	vuMeterSampleRate = 22050
+	// vuMeterRange is the range of the meter in dB, below which it is off
+	vuMeterRange = 60.0
+)
+
+// VuMeter shows the peak level of the default sink on the LED meter. The samples are read from a record stream of
+// the monitor source of the sink, which is only running while the meter is active.
+//
+// A meter is owned by the event loop, which has to call Frame for every value received from Frames.
+type VuMeter struct {
+	config VuMeterConfig
+	output func(value uint8)
+
+	cmd    *exec.Cmd
+	ticker *time.Ticker
+	// readDone is closed when the goroutine reading the samples returned, after which the command can be waited for
+	readDone chan struct{}
+	// peak is the highest sample since the last frame, written by the goroutine reading the samples
+	peak  int32
+	level float64
+	hold  time.Time
+	last  int
+}
+
+func NewVuMeter(config VuMeterConfig, output func(value uint8)) *VuMeter {
+	return &VuMeter{
+		config: config,
+		output: output,
+		last:   -1,
+		level:  -vuMeterRange,
+	}
+}
+
+// SetActive starts or stops sampling, the meter is switched off while it is not active
+func (m *VuMeter) SetActive(active bool) {
+	if active == m.Active() {
+		return
+	}
+
+	if active {
+		err := m.start()
+		if err != nil {
+			log.Printf("error while starting the vu meter: %v", err)
+		}
+	} else {
+		m.stopSampling()
+	}
+}
+
+func (m *VuMeter) Active() bool {
+	return m.cmd != nil
+}
+
+// Frames returns the channel on which a value is received when the next frame has to be shown, or nil while the
+// meter is not active
+func (m *VuMeter) Frames() <-chan time.Time {
+	if m.ticker == nil {
+		return nil
+	}
+
+	return m.ticker.C
+}
+
+// Refresh writes the level again with the next frame, after the controller was reset
+func (m *VuMeter) Refresh() {
+	m.last = -1
+	if !m.Active() {
+		m.write(0)
+	}
+}
+
+func (m *VuMeter) Close() {
+	m.SetActive(false)
+}
+
+func (m *VuMeter) start() error {
+	cmd := exec.Command("parec",
+		"--device=@DEFAULT_MONITOR@",
+		"--client-name=midi-media-controller",
+		"--stream-name=VU meter",
+		"--format=s16le",
+		"--channels=2",
+		"--rate="+strconv.Itoa(vuMeterSampleRate),
+		"--latency-msec="+strconv.Itoa(1000/m.config.FrameRate),
+		"--raw",
+	)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	m.cmd = cmd
+	m.ticker = time.NewTicker(m.interval())
+	m.readDone = make(chan struct{})
+
+	go m.read(stdout, m.readDone)
+
+	return nil
+}
+
+// stopSampling kills the command and waits for the samples to be read until the end of the output, as the command may
+// only be waited for after all reads
+func (m *VuMeter) stopSampling() {
+	m.cmd.Process.Kill()
+	<-m.readDone
+	m.cmd.Wait()
+	m.cmd = nil
+	m.readDone = nil
+
+	m.ticker.Stop()
+	m.ticker = nil
+
+	m.level = -vuMeterRange
+	m.write(0)
+}
+
+func (m *VuMeter) interval() time.Duration {
+	return time.Second / time.Duration(m.config.FrameRate)
+}
+
+// read keeps the highest sample since the last frame, until the output ends. done is closed when it returns.
+func (m *VuMeter) read(r io.Reader, done chan struct{}) {
+	defer close(done)
+
+	reader := bufio.NewReader(r)
+	sample := make([]byte, 2)
+
+	for {
+		_, err := io.ReadFull(reader, sample)
+		if err != nil {
+			return
+		}
+
+		value := int32(int16(binary.LittleEndian.Uint16(sample)))
+		if value < 0 {
+			value = -value
+		}
+
+		for {
+			peak := atomic.LoadInt32(&m.peak)
+			if value <= peak || atomic.CompareAndSwapInt32(&m.peak, peak, value) {
+				break
+			}
+		}
+	}
+}
+
+// Frame shows the peak level since the last frame. A peak is held for the configured time, after which the level
+// decays.
+func (m *VuMeter) Frame(now time.Time) {
+	if !m.Active() {
+		return
+	}
+
+	peak := atomic.SwapInt32(&m.peak, 0)
+	level := -vuMeterRange
+	if peak > 0 {
+		level = 20 * math.Log10(float64(peak)/math.MaxInt16)
+	}
+
+	if level >= m.level {
+		m.level = level
+		m.hold = now.Add(time.Duration(m.config.PeakHold * float64(time.Second)))
+	} else if now.After(m.hold) {
+		m.level = math.Max(level, m.level-m.config.Decay*m.interval().Seconds())
+	}
+
+	m.write(clampMidiValue(int((m.level + vuMeterRange) * 127 / vuMeterRange)))
+}
+
+func (m *VuMeter) write(value uint8) {
+	if int(value) != m.last {
+		m.last = int(value)
+		m.output(value)
+	}
+}